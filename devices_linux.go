@@ -0,0 +1,51 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+func readSysfs(dev, attr string) string {
+	data, err := os.ReadFile(filepath.Join("/sys/block", dev, attr))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+func formatDeviceSize(n int64) string {
+	units := []string{"B", "K", "M", "G", "T", "P"}
+	value := float64(n)
+	unit := 0
+	for value >= 1024 && unit < len(units)-1 {
+		value /= 1024
+		unit++
+	}
+	return fmt.Sprintf("%.1f%s", value, units[unit])
+}
+
+// Sizes in /sys/block are always given in 512 byte sectors.
+func listDevices(w io.Writer) error {
+	entries, err := os.ReadDir("/sys/block")
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "%-12s %12s %-10s %s\n", "DEVICE", "SIZE", "ROTATIONAL", "BLOCKSIZE")
+	for _, entry := range entries {
+		dev := entry.Name()
+		sectors, _ := strconv.ParseInt(readSysfs(dev, "size"), 10, 64)
+		rotational := "no"
+		if readSysfs(dev, "queue/rotational") == "1" {
+			rotational = "yes"
+		}
+		fmt.Fprintf(w, "%-12s %12s %-10s %s\n", "/dev/"+dev, formatDeviceSize(sectors*512), rotational, readSysfs(dev, "queue/logical_block_size"))
+	}
+	return nil
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+	"io"
+)
+
+func listDevices(w io.Writer) error {
+	return errors.New("listing devices is only supported on Linux")
+}
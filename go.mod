@@ -0,0 +1,3 @@
+module github.com/andreas-hofmann/groughput
+
+go 1.24
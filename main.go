@@ -1,168 +1,740 @@
-package main
-
-import (
-	"encoding/csv"
-	"errors"
-	"flag"
-	"fmt"
-	"os"
-	"os/signal"
-	"syscall"
-	"time"
-)
-
-type Config struct {
-	Chunksize  int
-	IntervalMs time.Duration
-	Sync       bool
-	Outfile    string
-}
-
-type Statistics struct {
-	WrittenBytes      int
-	WrittenBytesTotal int
-	LastUpdate        time.Time
-	Start             time.Time
-}
-
-type App struct {
-	outfile   *os.File
-	csvfile   *os.File
-	csvwriter *csv.Writer
-	cfg       Config
-	stats     Statistics
-	data      []byte
-}
-
-func (a *App) write() (int, error) {
-	written, err := a.outfile.Write(a.data)
-	if err != nil {
-		fmt.Fprintln(os.Stderr, "Error writing data:", err)
-		return 0, err
-	}
-
-	if written != a.cfg.Chunksize {
-		fmt.Fprintf(os.Stderr, "Could only write %d bytes\n", a.cfg.Chunksize-written)
-	}
-
-	if a.cfg.Sync {
-		a.outfile.Sync()
-	}
-
-	a.stats.WrittenBytes += written
-	a.stats.WrittenBytesTotal += written
-
-	return written, nil
-}
-
-func (a *App) gatherStats() {
-	for {
-		_, err := a.write()
-		if err != nil {
-			fmt.Fprintln(os.Stderr, "Error during write: ", err)
-			os.Exit(1)
-		}
-	}
-}
-
-func (a *App) collectStats() {
-	for {
-		duration := time.Now().Sub(a.stats.LastUpdate)
-		written := a.stats.WrittenBytes
-		bytes := int64(written) * 1000 / int64(duration.Milliseconds())
-
-		mbytes := float64(bytes) / 1024 / 1024
-
-		fmt.Printf("%f MByte/s\n", mbytes)
-
-		a.csvwriter.Write([]string{
-			time.Now().Format("2006-01-02_15-04-05"),
-			fmt.Sprintf("%f", time.Now().Sub(a.stats.Start).Seconds()),
-			fmt.Sprintf("%f", mbytes),
-		})
-		a.csvwriter.Flush()
-
-		a.stats.LastUpdate = time.Now()
-		a.stats.WrittenBytes = 0
-
-		time.Sleep(a.cfg.IntervalMs)
-	}
-}
-
-func (a *App) getFinalStats() {
-	duration := time.Now().Sub(a.stats.Start)
-	written := a.stats.WrittenBytesTotal
-	bytes := int64(written) * 1000 / int64(duration.Milliseconds())
-	mbytes := float64(bytes) / 1024 / 1024
-
-	fmt.Printf("Total: %f MByte/s\n", mbytes)
-
-	a.csvwriter.Write([]string{
-		time.Now().Format("2006-01-02_15-04-05"),
-		fmt.Sprintf("%f", duration.Seconds()),
-		fmt.Sprintf("%f", mbytes),
-		"End",
-	})
-	a.csvwriter.Flush()
-}
-
-func (a *App) Run() {
-	a.stats.Start = time.Now()
-
-	go a.collectStats()
-	go a.gatherStats()
-}
-
-func NewApp(cfg Config) *App {
-	file, err := os.OpenFile(cfg.Outfile, os.O_APPEND|os.O_WRONLY, os.ModeAppend)
-	if errors.Is(err, os.ErrNotExist) {
-		file, err = os.Create(cfg.Outfile)
-		if err != nil {
-			fmt.Fprintln(os.Stderr, "Error creating app:", err)
-			return nil
-		}
-	} else if err != nil {
-		fmt.Fprintln(os.Stderr, "Error creating app:", err)
-		return nil
-	}
-
-	csvfile, err := os.Create(fmt.Sprintf("%s.csv", time.Now().Format("2006-01-02_15-04-05")))
-	if err != nil {
-		fmt.Fprintln(os.Stderr, "Error creating app:", err)
-		return nil
-	}
-
-	csvWriter := csv.NewWriter(csvfile)
-
-	return &App{file, csvfile, csvWriter, cfg, Statistics{}, make([]byte, cfg.Chunksize, cfg.Chunksize)}
-}
-
-func main() {
-	bs := flag.Int("chunksize", 65536, "The default chunksize to write")
-	intv := flag.Int("interval", 250, "The default interval to gather statistics in ms")
-	sync := flag.Bool("sync", true, "Sync after every write")
-
-	flag.Parse()
-
-	outfiles := flag.Args()
-
-	if len(outfiles) != 1 {
-		fmt.Fprintf(os.Stderr, "Exactly one output file required\n")
-		os.Exit(1)
-	}
-
-	out := outfiles[0]
-	cfg := Config{*bs, time.Duration(*intv * 1000 * 1000), *sync, out}
-	app := NewApp(cfg)
-
-	cancelChan := make(chan os.Signal, 1)
-	signal.Notify(cancelChan, syscall.SIGTERM, syscall.SIGINT)
-
-	if app != nil {
-		app.Run()
-
-		<-cancelChan
-
-		app.getFinalStats()
-	}
-}
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"math"
+	"os"
+	"os/signal"
+	"regexp"
+	"runtime"
+	"runtime/pprof"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/andreas-hofmann/groughput/throughput"
+)
+
+// Set at build time via -ldflags "-X main.version=...".
+var (
+	version = "dev"
+	commit  = "unknown"
+	date    = "unknown"
+)
+
+func parseSize(s string) (int64, error) {
+	units := map[string]int64{
+		"K": 1 << 10,
+		"M": 1 << 20,
+		"G": 1 << 30,
+		"T": 1 << 40,
+	}
+
+	orig := s
+	s = strings.TrimSpace(s)
+	multiplier := int64(1)
+	if len(s) > 0 {
+		if m, ok := units[strings.ToUpper(s[len(s)-1:])]; ok {
+			multiplier = m
+			s = s[:len(s)-1]
+		}
+	}
+
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q", orig)
+	}
+	if n < 0 {
+		return 0, fmt.Errorf("size must not be negative")
+	}
+	if n > math.MaxInt64/multiplier {
+		return 0, fmt.Errorf("size %q is too large", orig)
+	}
+
+	return n * multiplier, nil
+}
+
+// Sizes held in an int, such as the chunk size, must also fit in one on
+// 32-bit platforms.
+func parseIntSize(s string) (int, error) {
+	n, err := parseSize(s)
+	if err != nil {
+		return 0, err
+	}
+	if n > math.MaxInt {
+		return 0, fmt.Errorf("size %q is too large", s)
+	}
+	return int(n), nil
+}
+
+// A byte count accepting the same suffixes as parseSize, up to the
+// largest int.
+type sizeFlag int
+
+func (s *sizeFlag) String() string {
+	return strconv.Itoa(int(*s))
+}
+
+func (s *sizeFlag) Set(value string) error {
+	n, err := parseIntSize(value)
+	if err != nil {
+		return err
+	}
+	*s = sizeFlag(n)
+	return nil
+}
+
+// Collects every occurrence of a repeatable flag.
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+func validateChunkInterval(chunksize, interval int) error {
+	if chunksize <= 0 {
+		return fmt.Errorf("chunksize must be positive, got %d", chunksize)
+	}
+	if interval <= 0 {
+		return fmt.Errorf("interval must be positive, got %d", interval)
+	}
+	return nil
+}
+
+var timeTokens = regexp.MustCompile(`\\[{}]|\{([^{}]+)\}`)
+
+// Expands every {layout} in a path to the time formatted with that Go
+// reference time layout, e.g. bench_{2006-01-02_15-04-05}.dat. \{ and \}
+// stand for literal braces.
+func expandPath(path string, t time.Time) string {
+	return timeTokens.ReplaceAllStringFunc(path, func(token string) string {
+		if token[0] == '\\' {
+			return token[1:]
+		}
+		return t.Format(token[1 : len(token)-1])
+	})
+}
+
+// Parses a comma separated list of percentages between 0 and 100 and
+// returns them in ascending order.
+func parsePercentages(s string) ([]float64, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	var percentages []float64
+	for _, field := range strings.Split(s, ",") {
+		p, err := strconv.ParseFloat(strings.TrimSpace(field), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid percentage %q", field)
+		}
+		if p <= 0 || p >= 100 {
+			return nil, fmt.Errorf("percentage %v must be above 0 and below 100", p)
+		}
+		percentages = append(percentages, p)
+	}
+	slices.Sort(percentages)
+	return percentages, nil
+}
+
+func parseBurst(s string) (on, off time.Duration, err error) {
+	if s == "" {
+		return 0, 0, nil
+	}
+
+	write, idle, ok := strings.Cut(s, "/")
+	if !ok {
+		return 0, 0, fmt.Errorf("%q is not of the form <write>/<idle>", s)
+	}
+	if on, err = time.ParseDuration(write); err != nil {
+		return 0, 0, err
+	}
+	if off, err = time.ParseDuration(idle); err != nil {
+		return 0, 0, err
+	}
+	if on <= 0 || off <= 0 {
+		return 0, 0, fmt.Errorf("both phases must be positive")
+	}
+	return on, off, nil
+}
+
+// Flags given on the command line win over the environment, which wins over
+// the defaults. A variable is ignored once any of its flags was given,
+// GRUFPUT_SYNC stands for -syncmode as well as the older -sync.
+var envFlags = map[string][]string{
+	"GRUFPUT_CHUNKSIZE": {"chunksize"},
+	"GRUFPUT_INTERVAL":  {"interval"},
+	"GRUFPUT_SYNC":      {"syncmode", "sync"},
+}
+
+func applyEnv(flags *flag.FlagSet) error {
+	set := map[string]bool{}
+	flags.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	for env, names := range envFlags {
+		value, ok := os.LookupEnv(env)
+		if !ok || slices.ContainsFunc(names, func(name string) bool { return set[name] }) {
+			continue
+		}
+		name := names[0]
+		if _, err := strconv.ParseBool(value); err == nil && env == "GRUFPUT_SYNC" {
+			name = "sync"
+		}
+		if err := flags.Set(name, value); err != nil {
+			return fmt.Errorf("%s: %w", env, err)
+		}
+	}
+	return nil
+}
+
+// Existing data is only written over after the user agreed to it on a
+// terminal, scripts have to pass -force.
+func confirmTargets(paths []string, openMode string) error {
+	action := map[string]string{
+		"append":    "append to it",
+		"truncate":  "truncate it",
+		"overwrite": "overwrite it from the start",
+	}[openMode]
+
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil || !(info.Mode().IsRegular() && info.Size() > 0 || info.Mode()&os.ModeDevice != 0 && info.Mode()&os.ModeCharDevice == 0) {
+			continue
+		}
+
+		question := fmt.Sprintf("%s holds %d bytes, %s?", path, info.Size(), action)
+		if !info.Mode().IsRegular() {
+			question = fmt.Sprintf("%s is a block device, overwrite it?", path)
+		}
+
+		if !isTerminal(os.Stdin) {
+			return fmt.Errorf("%s exists and is not empty, refusing to write without -force", path)
+		}
+		fmt.Fprintf(os.Stderr, "%s [y/N] ", question)
+		answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		if a := strings.ToLower(strings.TrimSpace(answer)); a != "y" && a != "yes" {
+			return fmt.Errorf("not writing to %s", path)
+		}
+	}
+	return nil
+}
+
+// The returned function stops the profile and closes its file, Run returns
+// on signals too, so the profile is complete either way.
+func startCPUProfile(path string) (func(), error) {
+	if path == "" {
+		return func() {}, nil
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := pprof.StartCPUProfile(file); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return func() {
+		pprof.StopCPUProfile()
+		if err := file.Close(); err != nil {
+			slog.Error("writing CPU profile failed", "err", err)
+		}
+	}, nil
+}
+
+func writeMemProfile(path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	runtime.GC()
+	if err := pprof.WriteHeapProfile(file); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// Diagnostics go through slog, the periodic throughput lines stay plain.
+func newLogger(format string) (*slog.Logger, error) {
+	switch format {
+	case "text":
+		return slog.New(slog.NewTextHandler(os.Stderr, nil)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(os.Stderr, nil)), nil
+	}
+	return nil, fmt.Errorf("invalid log format %q, must be text or json", format)
+}
+
+func handleSignals(ctx context.Context, app *throughput.App) {
+	if len(snapshotSignals) == 0 {
+		return
+	}
+
+	snapshots := make(chan os.Signal, 1)
+	signal.Notify(snapshots, snapshotSignals...)
+	defer signal.Stop(snapshots)
+
+	rotations := make(chan os.Signal, 1)
+	signal.Notify(rotations, rotateSignals...)
+	defer signal.Stop(rotations)
+
+	pauses := make(chan os.Signal, 1)
+	signal.Notify(pauses, pauseSignals...)
+	defer signal.Stop(pauses)
+
+	for {
+		select {
+		case <-pauses:
+			app.TogglePause()
+		case <-snapshots:
+			app.PrintSnapshot()
+		case <-rotations:
+			if err := app.Rotate(); err != nil {
+				slog.Error("rotating statistics file failed", "err", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func main() {
+	bs := sizeFlag(65536)
+	flag.Var(&bs, "chunksize", "The default chunksize to write, e.g. 4096, 64K or 1M")
+	intv := flag.Int("interval", 250, "The default interval to gather statistics in ms")
+	sync := flag.Bool("sync", true, "Sync after every write (deprecated, use -syncmode)")
+	syncMode := flag.String("syncmode", "", "Sync after every write: none, fdatasync or fsync (default fsync, or none with -sync=false)")
+	mode := flag.String("mode", "write", "Benchmark mode: write or read")
+	pattern := flag.String("pattern", "zero", "Data to write: zero, random or incompressible (buffer is filled once and reused)")
+	statsfile := flag.String("statsfile", "", "Path of the statistics file, - for stdout (default <timestamp>.<format>)")
+	ewma := flag.Float64("ewma", 0, "Smoothing factor (0-1] of an exponential moving average shown on the console (0 disables)")
+	unit := flag.String("unit", "MB", "Unit of the console throughput: auto, KB, MB or GB (statistics file always uses MByte/s)")
+	label := flag.String("label", "", "Label written to every row of the statistics file")
+	verify := flag.Bool("verify", false, "Read the written data back and compare it after the run (requires -limit or -duration)")
+	infile := flag.String("infile", "", "Write the content of this file instead of -pattern, cycling through it")
+	metricsAddr := flag.String("metrics-addr", "", "Serve Prometheus metrics on this address at /metrics, e.g. :9100")
+	random := flag.Bool("random", false, "Write each chunk to a random chunksize aligned offset within -filesize (pwrite)")
+	filesize := flag.String("filesize", "0", "Size of the file preallocated for -random, e.g. 1G")
+	seed := flag.Int64("seed", 0, "Seed of the random pattern, -random offsets and -rwmix choices (0 seeds from the current time and prints it)")
+	histfile := flag.String("histfile", "", "Write a histogram of the write latencies (power-of-two µs buckets) to this CSV file at the end")
+	osync := flag.Bool("osync", false, "Open the file with O_SYNC, the kernel syncs every write and -syncmode is ignored")
+	odsync := flag.Bool("odsync", false, "Open the file with O_DSYNC, the kernel syncs the data of every write and -syncmode is ignored")
+	quiet := flag.Bool("quiet", false, "Only print and record the final total, no interval statistics")
+	listen := flag.String("listen", "", "Accept a TCP connection per worker on this address and measure the receive throughput")
+	timefmt := flag.String("timefmt", "rfc3339nano", "Timestamps of the statistics file: compact, rfc3339, rfc3339nano or unixnano")
+	burst := flag.String("burst", "", "Duty cycle of bursty writes as <write>/<idle>, e.g. 200ms/800ms")
+	appendCSV := flag.String("append-csv", "", "Append the statistics to this CSV file, the header is only written to an empty file")
+	dryRun := flag.Bool("dry-run", false, "Print what would be done and exit without writing")
+	batch := flag.Int("batch", 1, "Chunks written per writev call, cuts the number of write syscalls by this factor (1-1024)")
+	spark := flag.Bool("spark", false, "Show a sparkline of the recent interval throughput on the console")
+	subsample := flag.Duration("subsample", 0, "Sample the throughput at this finer period and report min, max and mean per interval, e.g. 50ms, the interval must be a multiple of it")
+	truncate := flag.Bool("truncate", false, "Truncate existing output files instead of appending to them (same as -open-mode truncate)")
+	openMode := flag.String("open-mode", "append", "How existing output files are opened: append (write after their end), truncate (empty them first) or overwrite (write from offset 0, keep the rest)")
+	jsonSummary := flag.Bool("json-summary", false, "Print a JSON object summarizing the run to stdout at the end")
+	rwmix := flag.Int("rwmix", 0, "Percentage of writes in a mixed workload, the rest are reads of random chunks already in the file (0 disables)")
+	retryENOSPC := flag.Bool("retry-enospc", false, "Wait and retry when the disk is full instead of failing (for looped tests that free space meanwhile)")
+	compressRatio := flag.Float64("compress-ratio", 0, "Generate data compressing to about this ratio, e.g. 2.0 for 2:1, instead of -pattern (0 disables)")
+	noCSV := flag.Bool("no-csv", false, "Do not write a statistics file, console output only")
+	maxP99 := flag.Duration("max-p99", 0, "Exit with status 2 if the p99 latency of the run exceeds this, e.g. 5ms (0 disables)")
+	minThroughput := flag.Float64("min-throughput", 0, "Exit with status 2 if the throughput of the run is below this many MByte/s (0 disables)")
+	printEvery := flag.Int("print-every", 1, "Print one console line per this many intervals, averaged over them; every interval is still recorded")
+	logFormat := flag.String("log-format", "text", "Format of the diagnostic messages on stderr: text or json")
+	flushInterval := flag.Duration("flush-interval", 0, "Sync on this cadence instead of after every write, e.g. 100ms (0 disables)")
+	syncEvery := flag.Int("sync-every", 0, "Sync after every Nth write only, like a write-ahead log, -summary then shows the write and sync latencies apart (0 disables)")
+	flushBytes := flag.String("flush-bytes", "0", "Sync once this many bytes were written instead of after every write, e.g. 4M (0 disables)")
+	wrap := flag.String("wrap", "none", "Write through an io.Writer wrapper: none, buffered or gzip")
+	wrapSize := sizeFlag(65536)
+	flag.Var(&wrapSize, "wrap-size", "Buffer size of -wrap buffered, e.g. 1M")
+	force := flag.Bool("force", false, "Write to existing non-empty files and block devices without asking, and despite too little free space")
+	cpuprofile := flag.String("cpuprofile", "", "Write a CPU profile of the run to this file")
+	memprofile := flag.String("memprofile", "", "Write a heap profile taken after the run to this file")
+	var sinks listFlag
+	flag.Var(&sinks, "sink", "Destination of the interval statistics, repeatable: console, csv[:path] or jsonl[:path], - is stdout (default console and the -statsfile)")
+	sparseRatio := flag.Float64("sparse-ratio", 0, "Fraction of chunk sized regions left as holes instead of written, e.g. 0.5 (0 writes densely)")
+	window := flag.Duration("window", 0, "Show the average throughput over this trailing window on the console, e.g. 10s (0 disables)")
+	checksum := flag.String("checksum", "none", "Digest of the bytes written to every file, printed at the end: none, crc32 or sha256")
+	iouring := flag.Bool("iouring", false, "Submit the writes through io_uring with -qdepth entries per worker (Linux only, falls back to the standard path)")
+	drainTimeout := flag.Duration("drain-timeout", 10*time.Second, "How long to wait at shutdown for writes in flight to complete, later ones are not counted (0 waits without limit)")
+	device := flag.String("device", "", "Report the write amplification from the kernel's statistics of this block device, e.g. sda, or auto for the one holding the output file (Linux only)")
+	sweep := flag.String("sweep", "", "Run once per chunk size, e.g. 4K,16K,64K,256K,1M, each for -duration or ten intervals, and print the throughput per size")
+	quietWrites := flag.Bool("quiet-writes", false, "Do not log every short write, they are still counted in -summary")
+	progressFD := flag.Int("progress-fd", 0, "Write a JSON progress event per interval and a final done event to this file descriptor, e.g. 3 (0 disables)")
+	startAt := flag.String("start-at", "", "Wait until this RFC 3339 time, e.g. 2024-05-01T12:00:00Z, before writing, to start several instances in lockstep")
+	tail := flag.Bool("tail", false, "Print only the final throughput in MByte/s as a bare number to stdout, implies -quiet and -no-csv")
+	discard := flag.Bool("discard", false, "Discard every chunk in process instead of writing it, measures the ceiling of the tool itself (no output file)")
+	plot := flag.String("plot", "", "Write a script next to the CSV statistics file that plots the throughput to a PNG: gnuplot or matplotlib")
+	limitWarn := flag.String("limit-warn", "", "Log once when the bytes written cross these percentages of -limit, e.g. 90 or 50,90")
+	perWorkerCSV := flag.Bool("per-worker-csv", false, "Also write a CSV file per worker next to the statistics file and print the totals of every worker")
+	summary := flag.Bool("summary", false, "Print a summary of the run to stderr at the end")
+	rate := flag.Float64("rate", 0, "Target throughput in MByte/s (0 is unlimited)")
+	direct := flag.Bool("direct", false, "Open the file with O_DIRECT to bypass the page cache (chunksize must be a multiple of 4096)")
+	prealloc := flag.Bool("prealloc", false, "Preallocate the space given by -limit before writing")
+	qdepth := flag.Int("qdepth", 1, "Writes kept in flight per worker, above 1 positioned writes (pwrite) are used")
+	workers := flag.Int("workers", 1, "Number of parallel workers, each writing to <file>.N (readers share the file), several files are written round-robin")
+	format := flag.String("format", "csv", "Format of the statistics file: csv or jsonl")
+	noHeader := flag.Bool("no-header", false, "Do not write a header row to the CSV file")
+	count := flag.Int("count", 0, "Stop after the given number of write calls (0 is unlimited)")
+	limit := flag.String("limit", "0", "Stop after the given amount of bytes, e.g. 1G, 512M, 100K (0 is unlimited)")
+	warmup := flag.Duration("warmup", 0, "Warmup period excluded from the statistics, rounded up to whole intervals, e.g. 2s")
+	duration := flag.Duration("duration", 0, "Stop after the given duration, e.g. 30s (0 runs until interrupted)")
+
+	showVersion := flag.Bool("version", false, "Print version information and exit")
+	devices := flag.Bool("list-devices", false, "List the block devices with their size and exit (Linux only)")
+
+	flag.Parse()
+
+	// Nothing else is set up, so a bad environment cannot hide the version.
+	if *showVersion {
+		fmt.Printf("groughput %s (commit %s, built %s, %s)\n", version, commit, date, runtime.Version())
+		os.Exit(0)
+	}
+
+	// Without a logger there is nothing to route this error through.
+	logger, err := newLogger(*logFormat)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Invalid configuration:", err)
+		os.Exit(1)
+	}
+	slog.SetDefault(logger)
+
+	if err := applyEnv(flag.CommandLine); err != nil {
+		slog.Error("invalid environment", "err", err)
+		os.Exit(1)
+	}
+
+	if *devices {
+		if err := listDevices(os.Stdout); err != nil {
+			slog.Error("listing devices failed", "err", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	// All paths share one startup time, so the files of a run match.
+	started := time.Now()
+	outfiles := flag.Args()
+	for i, f := range outfiles {
+		outfiles[i] = expandPath(f, started)
+	}
+	*statsfile = expandPath(*statsfile, started)
+	*appendCSV = expandPath(*appendCSV, started)
+	for i, sink := range sinks {
+		sinks[i] = expandPath(sink, started)
+	}
+
+	if *discard {
+		if len(outfiles) > 0 || *listen != "" || *mode != "write" {
+			slog.Error("-discard writes nowhere, no output file, -listen or read mode allowed")
+			os.Exit(1)
+		}
+		outfiles = []string{os.DevNull}
+	}
+
+	if *listen != "" {
+		if len(outfiles) > 0 {
+			slog.Error("no output file allowed with -listen")
+			os.Exit(1)
+		}
+		*mode = "read"
+	} else if len(outfiles) == 0 {
+		slog.Error("at least one output file required")
+		os.Exit(1)
+	}
+
+	var out string
+	if len(outfiles) > 0 {
+		out = outfiles[0]
+	}
+
+	if *truncate {
+		if *openMode != "append" && *openMode != "truncate" {
+			slog.Error("-truncate cannot be combined with -open-mode", "open_mode", *openMode)
+			os.Exit(1)
+		}
+		*openMode = "truncate"
+	}
+
+	statsToStdout := *statsfile == "-"
+	for _, sink := range sinks {
+		statsToStdout = statsToStdout || strings.HasSuffix(sink, ":-")
+	}
+
+	if (*osync || *odsync) && (*syncMode == "fsync" || *syncMode == "fdatasync") {
+		slog.Warn("-syncmode is ignored with -osync or -odsync", "syncmode", *syncMode)
+	}
+	if *syncMode == "" {
+		*syncMode = "none"
+		if *sync {
+			*syncMode = "fsync"
+		}
+	}
+
+	flushBytesValue, err := parseSize(*flushBytes)
+	if err != nil {
+		slog.Error("invalid flush-bytes", "err", err)
+		os.Exit(1)
+	}
+
+	limitBytes, err := parseSize(*limit)
+	if err != nil {
+		slog.Error("invalid limit", "err", err)
+		os.Exit(1)
+	}
+	limitWarnings, err := parsePercentages(*limitWarn)
+	if err != nil {
+		slog.Error("invalid limit-warn", "err", err)
+		os.Exit(1)
+	}
+
+	filesizeBytes, err := parseSize(*filesize)
+	if err != nil {
+		slog.Error("invalid filesize", "err", err)
+		os.Exit(1)
+	}
+
+	burstOn, burstOff, err := parseBurst(*burst)
+	if err != nil {
+		slog.Error("invalid burst", "err", err)
+		os.Exit(1)
+	}
+
+	if *appendCSV != "" {
+		if *statsfile != "" || *format != "csv" {
+			slog.Error("-append-csv cannot be combined with -statsfile or -format jsonl")
+			os.Exit(1)
+		}
+		*statsfile = *appendCSV
+	}
+
+	if *tail {
+		if len(sinks) > 0 || *statsfile != "" || *jsonSummary || *sweep != "" || out == "-" {
+			slog.Error("-tail cannot be combined with -sink, -statsfile, -append-csv, -json-summary, -sweep or writing to stdout")
+			os.Exit(1)
+		}
+		*quiet, *noCSV = true, true
+	}
+
+	if len(sinks) > 0 && (*noCSV || *appendCSV != "" || *format != "csv" || *statsfile != "") {
+		slog.Error("-sink replaces -statsfile, -format, -append-csv and -no-csv")
+		os.Exit(1)
+	}
+
+	if *noCSV && (*statsfile != "" || *appendCSV != "") {
+		slog.Error("-no-csv cannot be combined with -statsfile or -append-csv")
+		os.Exit(1)
+	}
+
+	sweepSteps, err := parseSweep(*sweep)
+	if err != nil {
+		slog.Error("invalid sweep", "err", err)
+		os.Exit(1)
+	}
+	if len(sweepSteps) > 0 && (*listen != "" || *verify) {
+		slog.Error("a sweep cannot be combined with -listen or -verify")
+		os.Exit(1)
+	}
+
+	// A zero chunksize or interval would silently get the default.
+	if err := validateChunkInterval(int(bs), *intv); err != nil {
+		slog.Error("invalid configuration", "err", err)
+		os.Exit(1)
+	}
+
+	var startTime time.Time
+	if *startAt != "" {
+		startTime, err = time.Parse(time.RFC3339, *startAt)
+		if err != nil {
+			slog.Error("invalid start time", "err", err)
+			os.Exit(1)
+		}
+	}
+
+	cfg := throughput.Config{
+		Chunksize:     int(bs),
+		IntervalMs:    time.Duration(*intv * 1000 * 1000),
+		SyncMode:      *syncMode,
+		Outfile:       out,
+		Outfiles:      outfiles,
+		Mode:          *mode,
+		Duration:      *duration,
+		Limit:         limitBytes,
+		Pattern:       *pattern,
+		NoHeader:      *noHeader,
+		Format:        *format,
+		Workers:       *workers,
+		Direct:        *direct,
+		Rate:          *rate,
+		Summary:       *summary,
+		Statsfile:     *statsfile,
+		Warmup:        *warmup,
+		QueueDepth:    *qdepth,
+		Prealloc:      *prealloc,
+		EWMA:          *ewma,
+		Unit:          *unit,
+		Label:         *label,
+		Verify:        *verify,
+		Infile:        *infile,
+		MetricsAddr:   *metricsAddr,
+		Random:        *random,
+		Filesize:      filesizeBytes,
+		Seed:          *seed,
+		Histfile:      *histfile,
+		OSync:         *osync,
+		ODSync:        *odsync,
+		Quiet:         *quiet,
+		Listen:        *listen,
+		TimeFormat:    *timefmt,
+		BurstOn:       burstOn,
+		BurstOff:      burstOff,
+		AppendStats:   *appendCSV != "",
+		Batch:         *batch,
+		Spark:         *spark,
+		Subsample:     *subsample,
+		Truncate:      *openMode == "truncate",
+		OpenMode:      *openMode,
+		Plot:          *plot,
+		LimitWarn:     limitWarnings,
+		PerWorkerCSV:  *perWorkerCSV,
+		JSONSummary:   *jsonSummary,
+		RWMix:         *rwmix,
+		RetryENOSPC:   *retryENOSPC,
+		CompressRatio: *compressRatio,
+		NoCSV:         *noCSV,
+		Sinks:         sinks,
+		SparseRatio:   *sparseRatio,
+		Window:        *window,
+		Checksum:      *checksum,
+		IOURing:       *iouring,
+		DrainTimeout:  *drainTimeout,
+		Device:        *device,
+		QuietWrites:   *quietWrites,
+		ProgressFD:    *progressFD,
+		StartAt:       startTime,
+		Tail:          *tail,
+		MaxP99:        *maxP99,
+		MinThroughput: *minThroughput,
+		PrintEvery:    *printEvery,
+		FlushInterval: *flushInterval,
+		FlushBytes:    flushBytesValue,
+		SyncEvery:     *syncEvery,
+		Discard:       *discard,
+		Wrap:          *wrap,
+		WrapSize:      int(wrapSize),
+		Count:         *count,
+	}
+	if err := cfg.Validate(); err != nil {
+		slog.Error("invalid configuration", "err", err)
+		os.Exit(1)
+	}
+	for _, step := range sweepSteps {
+		segment := cfg
+		segment.Chunksize = step.chunksize
+		if err := segment.Validate(); err != nil {
+			slog.Error("invalid sweep", "chunksize", step.label, "err", err)
+			os.Exit(1)
+		}
+	}
+	if *dryRun {
+		cfg.Describe(os.Stdout)
+		os.Exit(0)
+	}
+
+	if cfg.Mode == "write" && !*force {
+		if err := confirmTargets(cfg.Targets(), cfg.OpenMode); err != nil {
+			slog.Error("not writing", "err", err)
+			os.Exit(1)
+		}
+	}
+
+	var space freeSpace
+	if cfg.Mode == "write" && !cfg.Discard {
+		space, err = checkFreeSpace(cfg, *force)
+		if err != nil {
+			slog.Error("not enough free space", "err", err)
+			os.Exit(1)
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+
+	if len(sweepSteps) > 0 {
+		table := os.Stdout
+		if out == "-" || statsToStdout {
+			table = os.Stderr
+		}
+		err := runSweep(ctx, cfg, sweepSteps, table)
+		space.report()
+		if err != nil {
+			slog.Error("sweep failed", "err", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	app, err := throughput.NewApp(cfg)
+	if err != nil {
+		slog.Error("creating app failed", "err", err)
+		os.Exit(1)
+	}
+	go handleSignals(ctx, app)
+
+	stopProfile, err := startCPUProfile(*cpuprofile)
+	if err != nil {
+		slog.Error("starting CPU profile failed", "err", err)
+		os.Exit(1)
+	}
+
+	runErr := app.Run(ctx)
+	stopProfile()
+
+	app.FinalStats()
+
+	if *memprofile != "" {
+		if err := writeMemProfile(*memprofile); err != nil {
+			slog.Error("writing memory profile failed", "err", err)
+		}
+	}
+
+	if err := app.Close(); err != nil {
+		slog.Error("closing app failed", "err", err)
+		os.Exit(1)
+	}
+	space.report()
+
+	if runErr != nil {
+		slog.Error("run failed", "err", runErr)
+		os.Exit(1)
+	}
+
+	if cfg.Verify {
+		mismatches, err := app.Verify()
+		if err != nil {
+			slog.Error("verifying data failed", "err", err)
+			os.Exit(1)
+		}
+		if mismatches > 0 {
+			os.Exit(1)
+		}
+	}
+
+	if violations := app.SLOViolations(); len(violations) > 0 {
+		for _, err := range violations {
+			slog.Error("SLO violated", "err", err)
+		}
+		os.Exit(2)
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int64
+		err  string
+	}{
+		{"0", 0, ""},
+		{"512", 512, ""},
+		{"64K", 64 << 10, ""},
+		{"4k", 4 << 10, ""},
+		{"1M", 1 << 20, ""},
+		{" 2G ", 2 << 30, ""},
+		{"", 0, "invalid size"},
+		{"K", 0, "invalid size"},
+		{"64KB", 0, "invalid size"},
+		{"1.5M", 0, "invalid size"},
+		{"0x10", 0, "invalid size"},
+		{"-1", 0, "must not be negative"},
+		{"-4K", 0, "must not be negative"},
+		{"1T", 1 << 40, ""},
+		{"8388607T", 8388607 << 40, ""},
+		{"8388608T", 0, "too large"},
+		{"16777216T", 0, "too large"},
+		{"9000000000000T", 0, "too large"},
+		{"9223372036854775807", 9223372036854775807, ""},
+		{"9223372036854775808", 0, "invalid size"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := parseSize(tt.in)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("parseSize(%q) = %d, %v, want an error containing %q", tt.in, got, err, tt.err)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("parseSize(%q) = %d, %v, want %d", tt.in, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestSizeFlag(t *testing.T) {
+	s := sizeFlag(65536)
+	if err := s.Set("1M"); err != nil || s != 1<<20 {
+		t.Fatalf("Set(1M) = %v, value %d", err, s)
+	}
+	if s.String() != "1048576" {
+		t.Errorf("String() = %q, want 1048576", s.String())
+	}
+	if err := s.Set("1X"); err == nil {
+		t.Error("Set(1X) succeeded, want an error")
+	}
+	if s != 1<<20 {
+		t.Errorf("a rejected value changed the flag to %d", s)
+	}
+
+	// 3G fits an int only on 64-bit platforms.
+	if _, err := parseIntSize("3G"); (err == nil) != (strconv.IntSize == 64) {
+		t.Errorf("parseIntSize(3G) = %v on a %d-bit platform", err, strconv.IntSize)
+	}
+}
+
+func TestApplyEnv(t *testing.T) {
+	tests := []struct {
+		name      string
+		env       map[string]string
+		args      []string
+		chunksize int
+		interval  int
+		sync      bool
+		syncMode  string
+		err       string
+	}{
+		{"defaults", nil, nil, 65536, 250, true, "", ""},
+		{"chunksize", map[string]string{"GRUFPUT_CHUNKSIZE": "1M"}, nil, 1 << 20, 250, true, "", ""},
+		{"flag wins", map[string]string{"GRUFPUT_CHUNKSIZE": "1M"}, []string{"-chunksize", "4K"}, 4096, 250, true, "", ""},
+		{"interval", map[string]string{"GRUFPUT_INTERVAL": "1000"}, nil, 65536, 1000, true, "", ""},
+		{"sync mode", map[string]string{"GRUFPUT_SYNC": "fdatasync"}, nil, 65536, 250, true, "fdatasync", ""},
+		{"sync false", map[string]string{"GRUFPUT_SYNC": "false"}, nil, 65536, 250, false, "", ""},
+		{"sync true", map[string]string{"GRUFPUT_SYNC": "true"}, nil, 65536, 250, true, "", ""},
+		{"syncmode wins", map[string]string{"GRUFPUT_SYNC": "fsync"}, []string{"-syncmode", "none"}, 65536, 250, true, "none", ""},
+		{"sync alias wins", map[string]string{"GRUFPUT_SYNC": "fsync"}, []string{"-sync=false"}, 65536, 250, false, "", ""},
+		{"invalid chunksize", map[string]string{"GRUFPUT_CHUNKSIZE": "big"}, nil, 0, 0, false, "", "GRUFPUT_CHUNKSIZE"},
+		{"invalid interval", map[string]string{"GRUFPUT_INTERVAL": "1s"}, nil, 0, 0, false, "", "GRUFPUT_INTERVAL"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for env := range envFlags {
+				if value, ok := tt.env[env]; ok {
+					t.Setenv(env, value)
+				} else {
+					t.Setenv(env, "")
+					os.Unsetenv(env)
+				}
+			}
+
+			flags := flag.NewFlagSet("groughput", flag.ContinueOnError)
+			bs := sizeFlag(65536)
+			flags.Var(&bs, "chunksize", "")
+			intv := flags.Int("interval", 250, "")
+			sync := flags.Bool("sync", true, "")
+			syncMode := flags.String("syncmode", "", "")
+			if err := flags.Parse(tt.args); err != nil {
+				t.Fatal(err)
+			}
+
+			err := applyEnv(flags)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got %v, want an error containing %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if int(bs) != tt.chunksize || *intv != tt.interval || *sync != tt.sync || *syncMode != tt.syncMode {
+				t.Errorf("got chunksize %d, interval %d, sync %t, syncmode %q, want %d, %d, %t, %q",
+					bs, *intv, *sync, *syncMode, tt.chunksize, tt.interval, tt.sync, tt.syncMode)
+			}
+		})
+	}
+}
+
+func TestExpandPath(t *testing.T) {
+	started := time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC)
+	tests := []struct {
+		in, want string
+	}{
+		{"bench.dat", "bench.dat"},
+		{"bench_{2006-01-02_15-04-05}.dat", "bench_2024-05-01_12-30-00.dat"},
+		{"{2006}/{01}/run.csv", "2024/05/run.csv"},
+		{`data\{1\}.dat`, "data{1}.dat"},
+		{`data\{2006\}.dat`, "data{2006}.dat"},
+		{`\{{15}\}.dat`, "{12}.dat"},
+		{"csv:stats_{15-04}.csv", "csv:stats_12-30.csv"},
+		{"{}.dat", "{}.dat"},
+		{`back\slash.dat`, `back\slash.dat`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			if got := expandPath(tt.in, started); got != tt.want {
+				t.Errorf("expandPath(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateChunkInterval(t *testing.T) {
+	tests := []struct {
+		chunksize, interval int
+		err                 string
+	}{
+		{1, 1, ""},
+		{65536, 250, ""},
+		{1 << 30, 1, ""},
+		{0, 250, "chunksize must be positive"},
+		{-1, 250, "chunksize must be positive"},
+		{65536, 0, "interval must be positive"},
+		{65536, -250, "interval must be positive"},
+		{0, 0, "chunksize must be positive"},
+	}
+	for _, tt := range tests {
+		err := validateChunkInterval(tt.chunksize, tt.interval)
+		if tt.err == "" && err != nil || tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+			t.Errorf("validateChunkInterval(%d, %d) = %v, want %q", tt.chunksize, tt.interval, err, tt.err)
+		}
+	}
+
+	if _, err := parseSweep("4K,0,1M"); err == nil {
+		t.Error("parseSweep accepted a chunk size of 0")
+	}
+}
@@ -0,0 +1,14 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+var (
+	snapshotSignals = []os.Signal{syscall.SIGUSR1}
+	rotateSignals   = []os.Signal{syscall.SIGHUP}
+	pauseSignals    = []os.Signal{syscall.SIGUSR2}
+)
@@ -0,0 +1,11 @@
+//go:build windows
+
+package main
+
+import "os"
+
+var (
+	snapshotSignals []os.Signal
+	rotateSignals   []os.Signal
+	pauseSignals    []os.Signal
+)
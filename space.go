@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/andreas-hofmann/groughput/throughput"
+)
+
+// The free space of the directories holding regular output files, taken
+// before the run so the space it used can be reported afterwards.
+type freeSpace map[string]uint64
+
+// Chunks are spread evenly over the targets, every directory needs its
+// share of the volume, or the preallocated size per file with -random.
+func checkFreeSpace(cfg throughput.Config, force bool) (freeSpace, error) {
+	need := map[string]uint64{}
+	targets := cfg.Targets()
+	for _, path := range targets {
+		if path == "-" || strings.HasPrefix(path, "tcp://") {
+			continue
+		}
+		if info, err := os.Stat(path); err == nil && !info.Mode().IsRegular() {
+			continue
+		}
+
+		dir := filepath.Dir(path)
+		share := uint64(cfg.Volume() / int64(len(targets)))
+		if cfg.Random {
+			share = uint64(cfg.Filesize)
+		}
+		need[dir] += share
+	}
+
+	space := freeSpace{}
+	for dir, bytes := range need {
+		free, err := availableSpace(dir)
+		if err != nil {
+			slog.Warn("free space unknown", "dir", dir, "err", err)
+			continue
+		}
+		space[dir] = free
+		slog.Info("free space", "dir", dir, "available", free)
+
+		if bytes > free {
+			if !force {
+				return nil, fmt.Errorf("%s has %d bytes free, the run needs %d, pass -force to write anyway", dir, free, bytes)
+			}
+			slog.Warn("not enough free space for the run", "dir", dir, "available", free, "needed", bytes)
+		}
+	}
+	return space, nil
+}
+
+func (s freeSpace) report() {
+	for dir, before := range s {
+		after, err := availableSpace(dir)
+		if err != nil {
+			continue
+		}
+		slog.Info("space used", "dir", dir, "bytes", int64(before)-int64(after), "available", after)
+	}
+}
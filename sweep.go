@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/andreas-hofmann/groughput/throughput"
+)
+
+type sweepStep struct {
+	label     string
+	chunksize int
+}
+
+func parseSweep(s string) ([]sweepStep, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	var steps []sweepStep
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		size, err := parseIntSize(field)
+		if err != nil {
+			return nil, err
+		}
+		if err := validateChunkInterval(size, 1); err != nil {
+			return nil, err
+		}
+		steps = append(steps, sweepStep{field, size})
+	}
+	return steps, nil
+}
+
+type sweepResult struct {
+	step   sweepStep
+	mbytes float64
+	bytes  int64
+}
+
+// Runs the benchmark once per chunk size, each run for -duration or ten
+// intervals. All runs share the statistics files, every row labeled with
+// its chunk size. Stops at the first failed run or when ctx is canceled.
+func runSweep(ctx context.Context, cfg throughput.Config, steps []sweepStep, table io.Writer) error {
+	if cfg.Duration == 0 {
+		cfg.Duration = 10 * cfg.IntervalMs
+	}
+	stamp := time.Now().Format("2006-01-02_15-04-05")
+	if len(cfg.Sinks) == 0 && !cfg.NoCSV && cfg.Statsfile == "" {
+		cfg.Statsfile = stamp + "." + cfg.Format
+	}
+	sinks := make([]string, len(cfg.Sinks))
+	for i, spec := range cfg.Sinks {
+		if kind, path, _ := strings.Cut(spec, ":"); kind != "console" && path == "" {
+			spec = kind + ":" + stamp + "." + kind
+		}
+		sinks[i] = spec
+	}
+	cfg.Sinks = sinks
+	label := cfg.Label
+
+	var results []sweepResult
+	var runErr error
+	for i, step := range steps {
+		if ctx.Err() != nil {
+			break
+		}
+
+		cfg.Chunksize = step.chunksize
+		cfg.Label = strings.TrimSpace(label + " " + step.label)
+		cfg.AppendStats = cfg.AppendStats || i > 0
+
+		app, err := throughput.NewApp(cfg)
+		if err != nil {
+			runErr = fmt.Errorf("chunksize %s: %w", step.label, err)
+			break
+		}
+		signals, stopSignals := context.WithCancel(ctx)
+		go handleSignals(signals, app)
+
+		slog.Info("sweeping", "chunksize", step.label, "duration", cfg.Duration)
+		err = app.Run(ctx)
+		stopSignals()
+		app.FinalStats()
+		stats := app.Stats()
+		if closeErr := app.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			runErr = fmt.Errorf("chunksize %s: %w", step.label, err)
+			break
+		}
+		results = append(results, sweepResult{step, stats.MBytes, stats.TotalBytes})
+		cfg.StartAt = time.Time{}
+	}
+
+	printSweep(table, results)
+	return runErr
+}
+
+func printSweep(w io.Writer, results []sweepResult) {
+	if len(results) == 0 {
+		return
+	}
+
+	best := results[0]
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(tw, "Chunksize\tMByte/s\tBytes\t\n")
+	for _, r := range results {
+		fmt.Fprintf(tw, "%s\t%.2f\t%d\t\n", r.step.label, r.mbytes, r.bytes)
+		if r.mbytes > best.mbytes {
+			best = r
+		}
+	}
+	tw.Flush()
+	fmt.Fprintf(w, "Best: %s at %.2f MByte/s\n", best.step.label, best.mbytes)
+}
@@ -0,0 +1,12 @@
+//go:build !linux && !windows
+
+package main
+
+import "os"
+
+// Without a terminal ioctl a character device is the best guess, which
+// mistakes /dev/null for a terminal.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,816 @@
+// Package throughput implements the benchmark engine behind groughput: it
+// writes (or reads) chunks to files and reports the achieved throughput.
+package throughput
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log/slog"
+	"math/rand"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type Config struct {
+	Chunksize     int
+	IntervalMs    time.Duration
+	SyncMode      string
+	Outfile       string
+	Outfiles      []string
+	Mode          string
+	Duration      time.Duration
+	Limit         int64
+	Pattern       string
+	NoHeader      bool
+	Format        string
+	Workers       int
+	Direct        bool
+	Rate          float64
+	Summary       bool
+	Statsfile     string
+	Warmup        time.Duration
+	QueueDepth    int
+	Prealloc      bool
+	EWMA          float64
+	Unit          string
+	Label         string
+	Verify        bool
+	Infile        string
+	MetricsAddr   string
+	Random        bool
+	Filesize      int64
+	Seed          int64
+	Histfile      string
+	OSync         bool
+	ODSync        bool
+	Quiet         bool
+	Listen        string
+	TimeFormat    string
+	BurstOn       time.Duration
+	BurstOff      time.Duration
+	AppendStats   bool
+	Batch         int
+	Spark         bool
+	Subsample     time.Duration
+	Truncate      bool
+	OpenMode      string
+	Plot          string
+	LimitWarn     []float64
+	PerWorkerCSV  bool
+	JSONSummary   bool
+	RWMix         int
+	RetryENOSPC   bool
+	CompressRatio float64
+	NoCSV         bool
+	Sinks         []string
+	SparseRatio   float64
+	Window        time.Duration
+	Checksum      string
+	IOURing       bool
+	DrainTimeout  time.Duration
+	Device        string
+	QuietWrites   bool
+	ProgressFD    int
+	StartAt       time.Time
+	Tail          bool
+	SyncEvery     int
+	Discard       bool
+	Stdout        io.Writer
+	Stderr        io.Writer
+	MaxP99        time.Duration
+	MinThroughput float64
+	PrintEvery    int
+	FlushInterval time.Duration
+	FlushBytes    int64
+	Wrap          string
+	WrapSize      int
+	Count         int
+}
+
+type Statistics struct {
+	WrittenBytes      int
+	WrittenBytesTotal int64
+	ReadBytes         int
+	ReadBytesTotal    int64
+	MaxLatency        time.Duration
+	Calls             int
+	IntervalCalls     int
+	ShortWrites       int
+	Intervals         int
+	MinMBytes         float64
+	MaxMBytes         float64
+	SumMBytes         float64
+	MeanMBytes        float64
+	M2MBytes          float64
+	LastMBytes        float64
+	Errors            int
+	SyncErrors        int
+	ENOSPCRetries     int
+	SlowCalls         int
+	Syncs             int
+	Stalls            int
+	Stalled           time.Duration
+	HoleBytes         int64
+	WriteSizes        writeSizes
+	WriteTime         time.Duration
+	SyncTime          time.Duration
+	PhysicalBytes     int64
+	LastUpdate        time.Time
+	Start             time.Time
+	End               time.Time
+	Paused            time.Duration
+	UserCPU           time.Duration
+	SystemCPU         time.Duration
+}
+
+const maxLatencySamples = 1 << 16
+
+const directAlignment = 4096
+
+type worker struct {
+	file          *os.File
+	reader        *os.File
+	data          []byte
+	stream        bool
+	offset        atomic.Int64
+	start         int64
+	end           atomic.Int64
+	written       int64
+	calls         int
+	warmupWritten int64
+	warmupCalls   int
+	unsynced      int64
+	unsyncedCalls int
+	wrap          wrapper
+	sum           hash.Hash
+	sumMu         sync.Mutex
+	ring          *ring
+	iovecs        iovecs
+}
+
+type App struct {
+	workers      []*worker
+	sinks        []StatsSink
+	sinkErr      error
+	console      io.Writer
+	cfg          Config
+	stats        Statistics
+	data         []byte
+	source       *os.File
+	srcsize      int64
+	cancel       context.CancelFunc
+	err          error
+	stop         chan struct{}
+	halted       sync.Once
+	wg           sync.WaitGroup
+	writers      sync.WaitGroup
+	frozen       bool
+	mu           sync.Mutex
+	statsMu      sync.Mutex
+	resumed      *sync.Cond
+	paused       bool
+	pausedAt     time.Time
+	claimed      int64
+	claimedCalls int
+	warming      bool
+	limiter      *rateLimiter
+	rng          *rand.Rand
+	metrics      net.Listener
+	bursts       time.Time
+	latencies    []time.Duration
+	spare        []time.Duration
+	align        int
+	spark        []float64
+	sparkPos     int
+	hist         histogram
+	ewma         float64
+	ewmaSet      bool
+	window       rollingWindow
+	diskstat     string
+	workerLogs   []*workerLog
+}
+
+func (a *App) shutdown() {
+	a.cancel()
+}
+
+// Records the first error of a worker and stops the benchmark, Run
+// returns the error.
+func (a *App) fail(err error) {
+	a.mu.Lock()
+	if a.err == nil {
+		a.err = err
+	}
+	a.mu.Unlock()
+
+	a.shutdown()
+}
+
+func (a *App) stopWorkers() {
+	a.halted.Do(func() { close(a.stop) })
+
+	// Wakes up paused workers so they see the stop.
+	a.mu.Lock()
+	a.resumed.Broadcast()
+	a.mu.Unlock()
+}
+
+// Stops the workers and waits for the writes in flight to complete, at
+// most -drain-timeout (0 waits as long as it takes). Writes still pending
+// after that are left out of the statistics.
+func (a *App) drain() {
+	a.stopWorkers()
+
+	done := make(chan struct{})
+	go func() {
+		a.writers.Wait()
+		close(done)
+	}()
+
+	var timeout <-chan time.Time
+	if a.cfg.DrainTimeout > 0 {
+		timer := time.NewTimer(a.cfg.DrainTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case <-done:
+	case <-timeout:
+		slog.Warn("writes still in flight after the drain timeout, not counted", "timeout", a.cfg.DrainTimeout)
+	}
+}
+
+// Stops all goroutines started by Run and waits for them to return, except
+// for workers stuck in a write past the drain timeout.
+func (a *App) halt() {
+	a.stopWorkers()
+	a.wg.Wait()
+}
+
+// TogglePause pauses the workers or lets them continue. The time spent
+// paused does not count towards the total throughput.
+func (a *App) TogglePause() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.paused = !a.paused
+	if a.paused {
+		a.pausedAt = time.Now()
+		slog.Info("paused")
+		return
+	}
+
+	a.stats.Paused += time.Since(a.pausedAt)
+	a.resumed.Broadcast()
+	slog.Info("resumed", "paused", time.Since(a.pausedAt))
+}
+
+// Blocks while paused, returns false if the app stopped meanwhile.
+func (a *App) waitResumed() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for a.paused && !a.stopped() {
+		a.resumed.Wait()
+	}
+	return !a.stopped()
+}
+
+// StatsSnapshot is a copy of the statistics of a running benchmark.
+type StatsSnapshot struct {
+	TotalBytes int64
+	ReadBytes  int64
+	Calls      int
+	Errors     int
+	Elapsed    time.Duration
+	MBytes     float64
+	LastMBytes float64
+}
+
+// Stats returns the current statistics, it is safe to call while Run is
+// in progress. Before Run started everything is zero.
+func (a *App) Stats() StatsSnapshot {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.stats.Start.IsZero() {
+		return StatsSnapshot{}
+	}
+	end := time.Now()
+	if !a.stats.End.IsZero() {
+		end = a.stats.End
+	}
+	elapsed := end.Sub(a.stats.Start) - a.stats.Paused
+	if a.paused {
+		elapsed -= end.Sub(a.pausedAt)
+	}
+
+	return StatsSnapshot{
+		TotalBytes: a.stats.WrittenBytesTotal,
+		ReadBytes:  a.stats.ReadBytesTotal,
+		Calls:      a.stats.Calls,
+		Errors:     a.stats.Errors + a.stats.SyncErrors,
+		Elapsed:    elapsed,
+		MBytes:     mbytesPerSecond(a.stats.WrittenBytesTotal, elapsed),
+		LastMBytes: a.stats.LastMBytes,
+	}
+}
+
+func (a *App) PrintSnapshot() {
+	stats := a.Stats()
+	fmt.Fprintf(a.cfg.Stderr, "Snapshot: %s after %v, %s\n", formatRate(stats.MBytes, a.cfg.Unit), stats.Elapsed.Round(time.Millisecond), formatBytes(stats.TotalBytes))
+}
+
+func (a *App) startTimer() {
+	if a.cfg.Duration > 0 {
+		time.AfterFunc(a.cfg.Duration, a.shutdown)
+	}
+}
+
+// Everything transferred during the warmup is dropped from the statistics
+// and does not count towards the limit or the call count. collectStats
+// ends it at the interval that closed at now, so the intervals after it
+// stay on the ticker grid.
+func (a *App) endWarmup(now time.Time) {
+	a.mu.Lock()
+	if a.cfg.Limit > 0 {
+		a.claimed -= a.stats.WrittenBytesTotal
+	}
+	a.claimedCalls -= a.stats.Calls
+	a.stats = Statistics{Start: now, LastUpdate: now}
+	for _, w := range a.workers {
+		w.warmupWritten, w.warmupCalls = w.written, w.calls
+	}
+	a.stats.UserCPU, a.stats.SystemCPU, _ = cpuTime()
+	a.stats.PhysicalBytes = a.physicalBytes()
+	a.latencies = a.latencies[:0]
+	a.hist = histogram{}
+	a.warming = false
+	a.mu.Unlock()
+
+	a.startTimer()
+}
+
+// Sleeps until -start-at, returns false if ctx is canceled meanwhile.
+func (a *App) waitStart(ctx context.Context) bool {
+	if a.cfg.StartAt.IsZero() {
+		return true
+	}
+	wait := time.Until(a.cfg.StartAt)
+	if wait <= 0 {
+		slog.Warn("start time already passed, starting now", "start", a.cfg.StartAt, "late", -wait)
+		return true
+	}
+
+	slog.Info("waiting for the start time", "start", a.cfg.StartAt, "wait", wait.Round(time.Millisecond))
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// Run blocks until ctx is canceled, the configured duration or limit is
+// reached or a transfer fails, then stops the benchmark. The error is the
+// one that aborted the run, if any.
+func (a *App) Run(ctx context.Context) error {
+	ctx, a.cancel = context.WithCancel(ctx)
+	defer a.cancel()
+
+	if !a.waitStart(ctx) {
+		a.mu.Lock()
+		a.stats.Start = time.Now()
+		a.stats.End = a.stats.Start
+		a.mu.Unlock()
+		return nil
+	}
+
+	// Stats may already be polled from another goroutine.
+	physical := a.physicalBytes()
+	a.mu.Lock()
+	a.stats.Start = time.Now()
+	a.stats.LastUpdate = a.stats.Start
+	a.stats.UserCPU, a.stats.SystemCPU, _ = cpuTime()
+	a.stats.PhysicalBytes = physical
+	a.bursts = a.stats.Start
+	a.warming = a.cfg.Warmup > 0
+	a.mu.Unlock()
+
+	if a.cfg.Warmup == 0 {
+		a.startTimer()
+	}
+
+	if a.metrics != nil {
+		defer stopMetrics(a.serveMetrics(a.metrics))
+	}
+
+	// With a queue depth above one every worker keeps several writes in
+	// flight, which only works with positioned writes at distinct offsets.
+	// With io_uring a single goroutine per worker keeps them in flight.
+	depth := max(a.cfg.QueueDepth, 1)
+	a.wg.Add(1)
+	go a.collectStats()
+	if a.cfg.FlushInterval > 0 {
+		a.wg.Add(1)
+		go a.flushLoop()
+	}
+	if a.cfg.IOURing {
+		a.writers.Add(len(a.workers))
+		for _, w := range a.workers {
+			go a.uringLoop(w)
+		}
+	} else {
+		a.writers.Add(a.cfg.Workers * depth)
+		files := len(outfiles(a.cfg))
+		for i := 0; i < len(a.workers); i += files {
+			for d := range depth {
+				go a.gatherStats(a.workers[i:i+files], d)
+			}
+		}
+	}
+
+	<-ctx.Done()
+	a.drain()
+	physical = a.physicalBytes()
+	a.mu.Lock()
+	a.frozen = true
+	a.stats.End = time.Now()
+	if a.stats.PhysicalBytes >= 0 && physical >= 0 {
+		a.stats.PhysicalBytes = physical - a.stats.PhysicalBytes
+	} else {
+		a.stats.PhysicalBytes = -1
+	}
+	if user, system, err := cpuTime(); err == nil {
+		a.stats.UserCPU = user - a.stats.UserCPU
+		a.stats.SystemCPU = system - a.stats.SystemCPU
+	}
+	if a.paused {
+		a.stats.Paused += a.stats.End.Sub(a.pausedAt)
+		a.pausedAt = a.stats.End
+	}
+	a.mu.Unlock()
+	a.halt()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.err
+}
+
+// Bytes the kernel wrote to the -device so far, -1 if unknown.
+func (a *App) physicalBytes() int64 {
+	if a.diskstat == "" {
+		return -1
+	}
+	sectors, err := sectorsWritten(a.diskstat)
+	if err != nil {
+		slog.Warn("reading disk statistics failed", "file", a.diskstat, "err", err)
+		return -1
+	}
+	return sectors * 512
+}
+
+func (a *App) Close() error {
+	a.halt()
+
+	var errs []error
+	for _, w := range a.workers {
+		if w.wrap != nil {
+			errs = append(errs, closeWrapper(w.wrap))
+		}
+		if w.ring != nil {
+			errs = append(errs, w.ring.close())
+		}
+		if w.file != os.Stdout {
+			errs = append(errs, w.file.Close())
+		}
+		if w.reader != nil {
+			errs = append(errs, w.reader.Close())
+		}
+	}
+
+	if a.source != nil {
+		errs = append(errs, a.source.Close())
+	}
+
+	errs = append(errs, a.closeSinks())
+
+	return errors.Join(errs...)
+}
+
+// Every chunk written is either a prefix of the pattern buffer or, when
+// streaming an input file, that file's content at the chunk's position, so
+// the written region is compared block by block against the same content.
+func (a *App) Verify() (int, error) {
+	buf := make([]byte, a.cfg.Chunksize)
+	expected := make([]byte, a.cfg.Chunksize)
+	blocks := 0
+	mismatches := 0
+	first := int64(-1)
+
+	// The input file was closed along with the app.
+	var source *os.File
+	if a.source != nil {
+		var err error
+		if source, err = os.Open(a.cfg.Infile); err != nil {
+			return 0, err
+		}
+		defer source.Close()
+	}
+
+	for _, w := range a.workers {
+		file, err := os.Open(w.file.Name())
+		if err != nil {
+			return 0, err
+		}
+
+		for off := w.start; off < w.start+w.written; off += int64(len(buf)) {
+			n := int(min(int64(len(buf)), w.start+w.written-off))
+			if _, err := file.ReadAt(buf[:n], off); err != nil {
+				file.Close()
+				return 0, err
+			}
+
+			if err := a.content(source, expected[:n], off-w.start); err != nil {
+				file.Close()
+				return 0, err
+			}
+
+			blocks++
+			if !bytes.Equal(buf[:n], expected[:n]) {
+				mismatches++
+				if first < 0 {
+					first = off
+					slog.Warn("first mismatch", "file", w.file.Name(), "offset", off)
+				}
+			}
+		}
+
+		file.Close()
+	}
+
+	slog.Info("verified", "mismatched", mismatches, "blocks", blocks)
+	return mismatches, nil
+}
+
+// NewApp validates the configuration, fills in the defaults of the fields
+// left at their zero value and opens the targets and statistics files.
+func NewApp(cfg Config) (*App, error) {
+	cfg = cfg.withDefaults()
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	if err := checkOpenFlags(cfg); err != nil {
+		return nil, err
+	}
+
+	if cfg.Listen != "" {
+		files, err := listenTCP(cfg.Listen, cfg.Workers)
+		if err != nil {
+			return nil, err
+		}
+		return newApp(cfg, files, make([]int64, len(files)))
+	}
+
+	if cfg.Mode != "read" && cfg.Workers > 1 {
+		for _, out := range outfiles(cfg) {
+			if isBlockDevice(out) {
+				return nil, fmt.Errorf("%s: a block device can only be written by a single worker", out)
+			}
+		}
+	}
+
+	var files []*os.File
+	fail := func(err error) (*App, error) {
+		closeFiles(files)
+		return nil, err
+	}
+	for _, path := range workerPaths(cfg) {
+		if err := checkTarget(path); err != nil {
+			return fail(err)
+		}
+
+		var file *os.File
+		var err error
+		if cfg.Mode == "read" {
+			file, err = openInfile(path, openFlags(cfg))
+		} else {
+			flags := openFlags(cfg)
+			if cfg.openMode() == "truncate" {
+				flags |= os.O_TRUNC
+			}
+			file, err = openOutfile(path, flags, cfg.openMode(), cfg.QueueDepth > 1 || cfg.Prealloc || cfg.Random || cfg.SparseRatio > 0)
+		}
+		if err != nil {
+			return fail(err)
+		}
+		files = append(files, file)
+	}
+
+	// Chunks are spread evenly over the files, so the smallest device
+	// bounds the run unless a limit was given.
+	if cfg.Mode != "read" && cfg.Limit == 0 && cfg.Count == 0 {
+		var smallest int64
+		for _, file := range files {
+			if !isBlockDevice(file.Name()) {
+				continue
+			}
+			size, err := deviceSize(file)
+			if err != nil {
+				return fail(fmt.Errorf("%s: device size: %w", file.Name(), err))
+			}
+			if smallest == 0 || size < smallest {
+				smallest = size
+			}
+		}
+		if smallest > 0 {
+			cfg.Limit = smallest * int64(len(files))
+			slog.Info("limit set to the block device size", "limit", formatBytes(cfg.Limit))
+		}
+	}
+
+	// The workers start behind what the files held before they were
+	// preallocated, which may have grown them.
+	sizes := make([]int64, len(files))
+	for i, file := range files {
+		if info, err := file.Stat(); err == nil {
+			sizes[i] = info.Size()
+		}
+	}
+
+	if cfg.Prealloc || cfg.Random {
+		size := (cfg.Limit + int64(len(files)) - 1) / int64(len(files))
+		if cfg.Random {
+			size = cfg.Filesize
+		}
+		for _, file := range files {
+			if isBlockDevice(file.Name()) {
+				continue
+			}
+			if err := preallocate(file, size); err != nil {
+				return fail(err)
+			}
+		}
+	}
+
+	return newApp(cfg, files, sizes)
+}
+
+func closeFiles(files []*os.File) {
+	for _, f := range files {
+		if f != os.Stdout {
+			f.Close()
+		}
+	}
+}
+
+// Takes over the files, they are closed again if it fails. sizes holds
+// what each file held before the benchmark touched it.
+func newApp(cfg Config, files []*os.File, sizes []int64) (app *App, err error) {
+	var cleanup []func() error
+	defer func() {
+		if err == nil {
+			return
+		}
+		for _, c := range cleanup {
+			c()
+		}
+		closeFiles(files)
+	}()
+
+	align := directAlignment
+	if cfg.Direct {
+		align = directAlign(files)
+		if err := checkAlignment(cfg, align); err != nil {
+			return nil, err
+		}
+	}
+
+	// One generator drives everything random, so a seed reproduces the
+	// pattern, the -random offsets and the -rwmix choices.
+	seed := cfg.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+		if cfg.Pattern == "random" || cfg.Random || cfg.RWMix > 0 || cfg.CompressRatio > 0 {
+			slog.Info("random generator seeded", "seed", seed)
+		}
+	}
+	rng := rand.New(rand.NewSource(seed))
+
+	data := newBuffer(cfg, align)
+	if err := fillPattern(data, cfg.Pattern, rng); err != nil {
+		return nil, err
+	}
+	if cfg.CompressRatio > 0 {
+		fillCompressible(data, cfg.CompressRatio, rng)
+	}
+
+	var source *os.File
+	var srcsize int64
+	if cfg.Infile != "" {
+		source, srcsize, err = loadInfile(cfg.Infile, data)
+		if err != nil {
+			return nil, err
+		}
+		if source != nil {
+			cleanup = append(cleanup, source.Close)
+		}
+	}
+
+	console := cfg.Stdout
+	if sinkToStdout(sinkSpecs(cfg)) || outfiles(cfg)[0] == "-" {
+		console = cfg.Stderr
+	}
+
+	workers := make([]*worker, len(files))
+	for i, file := range files {
+		workers[i] = &worker{file: file, data: data, wrap: newWrapper(cfg, file), sum: newChecksum(cfg.Checksum)}
+		info, err := file.Stat()
+		if file == os.Stdout || (err == nil && isStream(info)) {
+			workers[i].stream = true
+		} else if err == nil && cfg.openMode() != "overwrite" {
+			workers[i].offset.Store(sizes[i])
+			workers[i].start = sizes[i]
+		}
+		workers[i].end.Store(sizes[i])
+		if cfg.Mode == "read" {
+			workers[i].data = newBuffer(cfg, align)
+		}
+		if cfg.RWMix > 0 {
+			workers[i].reader, err = os.OpenFile(file.Name(), os.O_RDONLY|openFlags(cfg), 0)
+			if err != nil {
+				return nil, err
+			}
+			cleanup = append(cleanup, workers[i].reader.Close)
+		}
+	}
+
+	if cfg.IOURing {
+		for _, w := range workers {
+			r, err := newRing(cfg.QueueDepth)
+			if err != nil {
+				slog.Warn("io_uring not available, using the standard write path", "err", err)
+				cfg.IOURing = false
+				break
+			}
+			w.ring = r
+			cleanup = append(cleanup, r.close)
+		}
+	}
+
+	var limiter *rateLimiter
+	if cfg.Rate > 0 {
+		limiter = newRateLimiter(cfg.Rate, cfg.Chunksize)
+	}
+
+	var metrics net.Listener
+	if cfg.MetricsAddr != "" {
+		metrics, err = net.Listen("tcp", cfg.MetricsAddr)
+		if err != nil {
+			return nil, err
+		}
+		cleanup = append(cleanup, metrics.Close)
+	}
+
+	a := &App{
+		workers:   workers,
+		limiter:   limiter,
+		metrics:   metrics,
+		rng:       rng,
+		align:     align,
+		stop:      make(chan struct{}),
+		console:   console,
+		cfg:       cfg,
+		data:      data,
+		source:    source,
+		srcsize:   srcsize,
+		latencies: make([]time.Duration, 0, maxLatencySamples),
+		spare:     make([]time.Duration, 0, maxLatencySamples),
+	}
+	a.resumed = sync.NewCond(&a.mu)
+	if cfg.Device != "" {
+		diskstat, err := diskStatFile(cfg.Device, workers[0].file)
+		if err != nil {
+			slog.Warn("write amplification not available", "err", err)
+		}
+		a.diskstat = diskstat
+	}
+	if cfg.Window > 0 {
+		a.window = newRollingWindow(cfg.Window, cfg.IntervalMs)
+	}
+
+	if err := a.openSinks(); err != nil {
+		a.closeSinks()
+		return nil, err
+	}
+	return a, nil
+}
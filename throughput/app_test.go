@@ -0,0 +1,162 @@
+package throughput
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewAppDefaults(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "out.dat")
+	app, err := NewApp(Config{Workers: 1, Pattern: "zero", Mode: "write", Outfile: out, NoCSV: true, SyncMode: "none", Limit: 1 << 20, Stdout: io.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := app.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	stats := app.Stats()
+	if err := app.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if stats.TotalBytes != 1<<20 || stats.Calls != 16 {
+		t.Errorf("got %d bytes in %d calls, want %d bytes in 16 calls", stats.TotalBytes, stats.Calls, 1<<20)
+	}
+	info, err := os.Stat(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() != 1<<20 {
+		t.Errorf("file holds %d bytes, want %d", info.Size(), 1<<20)
+	}
+}
+
+func TestNewAppErrors(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name string
+		cfg  Config
+		want string
+	}{
+		{"directory", Config{Outfile: dir}, "is a directory"},
+		{"missing infile", Config{Outfile: filepath.Join(dir, "a.dat"), Infile: filepath.Join(dir, "missing")}, "no such file"},
+		{"empty infile", Config{Outfile: filepath.Join(dir, "b.dat"), Infile: os.DevNull}, "is empty"},
+		{"invalid pattern", Config{Outfile: filepath.Join(dir, "c.dat"), Pattern: "ones"}, "invalid pattern"},
+		{"no output file", Config{}, "output file required"},
+		{"missing read file", Config{Outfile: filepath.Join(dir, "missing"), Mode: "read"}, "no such file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cfg.NoCSV = true
+			app, err := NewApp(tt.cfg)
+			if err == nil {
+				app.Close()
+				t.Fatalf("NewApp succeeded, want an error containing %q", tt.want)
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("got %q, want an error containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewAppOutput(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	cfg := Config{
+		Outfile:     filepath.Join(t.TempDir(), "out.dat"),
+		NoCSV:       true,
+		SyncMode:    "none",
+		Limit:       1 << 20,
+		Summary:     true,
+		JSONSummary: true,
+		Stdout:      &stdout,
+		Stderr:      &stderr,
+	}
+	app, err := NewApp(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := app.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	app.FinalStats()
+	app.PrintSnapshot()
+	if err := app.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	total, summary, _ := strings.Cut(stdout.String(), "\n{")
+	if !strings.HasPrefix(total, "Total: ") {
+		t.Errorf("stdout starts with %q, want the total", total)
+	}
+	var decoded map[string]any
+	if err := json.Unmarshal([]byte("{"+summary), &decoded); err != nil {
+		t.Errorf("JSON summary: %v", err)
+	}
+	if decoded["total_bytes"] != float64(1<<20) {
+		t.Errorf("JSON summary total_bytes %v, want %d", decoded["total_bytes"], 1<<20)
+	}
+	if !strings.Contains(stderr.String(), "Summary:") || !strings.Contains(stderr.String(), "Snapshot: ") {
+		t.Errorf("stderr lacks the summary or the snapshot:\n%s", stderr.String())
+	}
+}
+
+func TestStatsWhileRunning(t *testing.T) {
+	app, err := NewApp(Config{
+		Outfile:    filepath.Join(t.TempDir(), "out.dat"),
+		NoCSV:      true,
+		SyncMode:   "none",
+		Chunksize:  4096,
+		IntervalMs: 10 * time.Millisecond,
+		Duration:   200 * time.Millisecond,
+		Workers:    2,
+		Stdout:     io.Discard,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer app.Close()
+
+	// Polling starts before Run, which must not race with its setup.
+	done := make(chan struct{})
+	polled := make(chan error)
+	go func() {
+		var last StatsSnapshot
+		for {
+			stats := app.Stats()
+			if stats.TotalBytes < last.TotalBytes || stats.Calls < last.Calls || stats.Elapsed < 0 {
+				polled <- fmt.Errorf("statistics went from %+v to %+v", last, stats)
+				return
+			}
+			last = stats
+			select {
+			case <-done:
+				polled <- nil
+				return
+			default:
+			}
+		}
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	if err := app.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	close(done)
+	if err := <-polled; err != nil {
+		t.Error(err)
+	}
+
+	stats := app.Stats()
+	if stats.TotalBytes == 0 || stats.Elapsed < 200*time.Millisecond {
+		t.Errorf("got %d bytes in %v, want a complete run", stats.TotalBytes, stats.Elapsed)
+	}
+}
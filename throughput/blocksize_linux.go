@@ -0,0 +1,32 @@
+//go:build linux
+
+package throughput
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	blkSSZGet    = 0x1268
+	blkGetSize64 = 0x80081272
+)
+
+func logicalBlockSize(f *os.File) (int, error) {
+	var size int32
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), blkSSZGet, uintptr(unsafe.Pointer(&size)))
+	if errno != 0 {
+		return 0, errno
+	}
+	return int(size), nil
+}
+
+func deviceSize(f *os.File) (int64, error) {
+	var size uint64
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), blkGetSize64, uintptr(unsafe.Pointer(&size)))
+	if errno != 0 {
+		return 0, errno
+	}
+	return int64(size), nil
+}
@@ -0,0 +1,16 @@
+//go:build !linux
+
+package throughput
+
+import (
+	"errors"
+	"os"
+)
+
+func logicalBlockSize(f *os.File) (int, error) {
+	return 0, errors.ErrUnsupported
+}
+
+func deviceSize(f *os.File) (int64, error) {
+	return 0, errors.ErrUnsupported
+}
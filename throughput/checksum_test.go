@@ -0,0 +1,85 @@
+package throughput
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestChecksumMatchesFile(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "out.dat")
+	app, err := NewApp(Config{
+		Outfile:   out,
+		NoCSV:     true,
+		SyncMode:  "none",
+		Chunksize: 4096,
+		Batch:     3,
+		Limit:     1<<20 + 1000,
+		Pattern:   "random",
+		Checksum:  "sha256",
+		Stdout:    io.Discard,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := app.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	digest := app.workers[0].digest()
+	if err := app.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(data)
+	if want := hex.EncodeToString(sum[:]); digest != want {
+		t.Errorf("digest %s, the file hashes to %s", digest, want)
+	}
+}
+
+// Takes the first max bytes, then fails.
+type failingWriter struct {
+	shortWriter
+}
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if w.Len() >= w.max {
+		return 0, errors.New("device gone")
+	}
+	return w.shortWriter.Write(p)
+}
+
+func TestChecksumSkipsFailedWrite(t *testing.T) {
+	app, err := NewApp(Config{
+		Outfile:     filepath.Join(t.TempDir(), "out.dat"),
+		NoCSV:       true,
+		SyncMode:    "none",
+		Chunksize:   4096,
+		Checksum:    "sha256",
+		QuietWrites: true,
+		Stdout:      io.Discard,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer app.Close()
+
+	w := app.workers[0]
+	w.wrap = &failingWriter{shortWriter{max: 1000}}
+	if _, err := app.write(w, [][]byte{w.data}, len(w.data), 0); err == nil {
+		t.Fatal("the write succeeded")
+	}
+
+	empty := sha256.Sum256(nil)
+	if digest := w.digest(); digest != hex.EncodeToString(empty[:]) {
+		t.Errorf("digest %s covers a failed write", digest)
+	}
+}
@@ -0,0 +1,296 @@
+package throughput
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+const maxChunksize = 1 << 30
+
+const maxBatch = 1024
+
+// Fills in what a Config left at its zero value, with the same defaults as
+// the command line.
+func (cfg Config) withDefaults() Config {
+	if cfg.Chunksize == 0 {
+		cfg.Chunksize = 65536
+	}
+	if cfg.IntervalMs == 0 {
+		cfg.IntervalMs = 250 * time.Millisecond
+	}
+	if cfg.Mode == "" {
+		cfg.Mode = "write"
+		if cfg.Listen != "" {
+			cfg.Mode = "read"
+		}
+	}
+	if cfg.Pattern == "" {
+		cfg.Pattern = "zero"
+	}
+	if cfg.SyncMode == "" {
+		cfg.SyncMode = "fsync"
+	}
+	if cfg.Workers == 0 {
+		cfg.Workers = 1
+	}
+	if cfg.QueueDepth == 0 {
+		cfg.QueueDepth = 1
+	}
+	if cfg.Batch == 0 {
+		cfg.Batch = 1
+	}
+	if cfg.PrintEvery == 0 {
+		cfg.PrintEvery = 1
+	}
+	if cfg.Format == "" {
+		cfg.Format = "csv"
+	}
+	if cfg.Unit == "" {
+		cfg.Unit = "MB"
+	}
+	if cfg.TimeFormat == "" {
+		cfg.TimeFormat = "rfc3339nano"
+	}
+	if cfg.Wrap == "" {
+		cfg.Wrap = "none"
+	}
+	if cfg.WrapSize == 0 {
+		cfg.WrapSize = 65536
+	}
+	if cfg.Checksum == "" {
+		cfg.Checksum = "none"
+	}
+	if cfg.Stdout == nil {
+		cfg.Stdout = os.Stdout
+	}
+	if cfg.Stderr == nil {
+		cfg.Stderr = os.Stderr
+	}
+	cfg.OpenMode = cfg.openMode()
+	if cfg.Discard && cfg.Outfile == "" && len(cfg.Outfiles) == 0 {
+		cfg.Outfile = os.DevNull
+	}
+	if cfg.Outfile == "" && len(cfg.Outfiles) > 0 {
+		cfg.Outfile = cfg.Outfiles[0]
+	}
+	return cfg
+}
+
+// Validate reports the first setting of the configuration that is out of
+// range or conflicts with another one. Fields left at their zero value are
+// validated with their defaults, NewApp calls it before opening anything.
+func (cfg Config) Validate() error {
+	cfg = cfg.withDefaults()
+
+	out := outfiles(cfg)[0]
+	seekable := out != "-" && !isTCP(out)
+	write := cfg.Mode == "write"
+
+	if cfg.Listen != "" {
+		if cfg.Outfile != "" || len(cfg.Outfiles) > 0 || cfg.Mode != "read" {
+			return errors.New("listening requires read mode and no output file")
+		}
+	} else if out == "" {
+		return errors.New("at least one output file required")
+	}
+	for _, f := range outfiles(cfg) {
+		if f == "-" && len(outfiles(cfg)) > 1 {
+			return errors.New("writing to stdout requires a single output file")
+		}
+	}
+	if cfg.Discard && (len(outfiles(cfg)) > 1 || out != os.DevNull || cfg.Listen != "" || !write) {
+		return errors.New("discarding writes nowhere, no output file, listening or read mode allowed")
+	}
+	if cfg.Discard && (cfg.Direct || cfg.IOURing || cfg.Verify || cfg.RWMix > 0 || cfg.Prealloc || cfg.Wrap != "none" || cfg.Device != "") {
+		return errors.New("discarding cannot be combined with direct I/O, io_uring, verification, a read/write mix, preallocation, a wrapper or a device")
+	}
+
+	if cfg.Chunksize < 0 {
+		return fmt.Errorf("chunksize must be positive, got %d", cfg.Chunksize)
+	}
+	if cfg.Chunksize > maxChunksize {
+		return fmt.Errorf("chunksize must not exceed %d bytes, got %d", maxChunksize, cfg.Chunksize)
+	}
+	if cfg.IntervalMs < 0 {
+		return fmt.Errorf("interval must be positive, got %v", cfg.IntervalMs)
+	}
+	if cfg.Subsample < 0 || cfg.Subsample >= cfg.IntervalMs {
+		return errors.New("subsample must be shorter than the interval")
+	}
+	if cfg.Subsample > 0 && cfg.IntervalMs%cfg.Subsample != 0 {
+		return fmt.Errorf("the interval of %v must be a multiple of the subsample of %v", cfg.IntervalMs, cfg.Subsample)
+	}
+
+	if !write && cfg.Mode != "read" {
+		return fmt.Errorf("invalid mode %q, must be write or read", cfg.Mode)
+	}
+	if cfg.Pattern != "zero" && cfg.Pattern != "random" && cfg.Pattern != "incompressible" {
+		return fmt.Errorf("invalid pattern %q, must be zero, random or incompressible", cfg.Pattern)
+	}
+	if cfg.OpenMode != "append" && cfg.OpenMode != "truncate" && cfg.OpenMode != "overwrite" {
+		return fmt.Errorf("invalid open mode %q, must be append, truncate or overwrite", cfg.OpenMode)
+	}
+	if cfg.Truncate && cfg.OpenMode != "truncate" {
+		return fmt.Errorf("truncating cannot be combined with open mode %s", cfg.OpenMode)
+	}
+	if cfg.Plot != "" && cfg.Plot != "gnuplot" && cfg.Plot != "matplotlib" {
+		return fmt.Errorf("invalid plot %q, must be gnuplot or matplotlib", cfg.Plot)
+	}
+	if cfg.Format != "csv" && cfg.Format != "jsonl" {
+		return fmt.Errorf("invalid format %q, must be csv or jsonl", cfg.Format)
+	}
+
+	statsToStdout := sinkToStdout(sinkSpecs(cfg))
+	if out == "-" && (!write || cfg.Workers > 1 || statsToStdout) {
+		return errors.New("writing to stdout requires write mode, a single worker and a real statistics file")
+	}
+	if cfg.Workers < 1 {
+		return errors.New("at least one worker required")
+	}
+	if cfg.QueueDepth < 1 {
+		return errors.New("queue depth must be at least 1")
+	}
+	if cfg.QueueDepth > 1 && (!write || !seekable) {
+		return errors.New("queue depth above 1 requires write mode and a seekable target")
+	}
+	if cfg.JSONSummary && out == "-" {
+		return errors.New("a JSON summary cannot be printed while writing to stdout")
+	}
+	if cfg.Prealloc && (!seekable || cfg.Limit == 0) {
+		return errors.New("preallocation requires a regular file and a limit")
+	}
+	if cfg.Window != 0 && cfg.Window < cfg.IntervalMs {
+		return errors.New("the window must be at least one interval")
+	}
+	if cfg.EWMA < 0 || cfg.EWMA > 1 {
+		return errors.New("EWMA smoothing factor must be between 0 and 1")
+	}
+	if cfg.TimeFormat != "compact" && cfg.TimeFormat != "rfc3339" && cfg.TimeFormat != "rfc3339nano" && cfg.TimeFormat != "unixnano" {
+		return fmt.Errorf("invalid time format %q, must be compact, rfc3339, rfc3339nano or unixnano", cfg.TimeFormat)
+	}
+	if cfg.Unit != "auto" && cfg.Unit != "KB" && cfg.Unit != "MB" && cfg.Unit != "GB" {
+		return fmt.Errorf("invalid unit %q, must be auto, KB, MB or GB", cfg.Unit)
+	}
+	if cfg.Rate < 0 {
+		return errors.New("rate must not be negative")
+	}
+
+	if cfg.SyncMode != "none" && cfg.SyncMode != "fdatasync" && cfg.SyncMode != "fsync" {
+		return fmt.Errorf("invalid sync mode %q, must be none, fdatasync or fsync", cfg.SyncMode)
+	}
+	syncing := write && cfg.SyncMode != "none" && !cfg.OSync && !cfg.ODSync
+	if cfg.FlushInterval < 0 || cfg.FlushBytes < 0 {
+		return errors.New("flush interval and flush bytes must not be negative")
+	}
+	if (cfg.FlushInterval > 0 || cfg.FlushBytes > 0) && !syncing {
+		return errors.New("a flush interval or flush bytes require write mode and a sync mode of fsync or fdatasync")
+	}
+	if cfg.SyncEvery < 0 {
+		return errors.New("sync every must not be negative")
+	}
+	if cfg.SyncEvery > 0 && (cfg.FlushInterval > 0 || cfg.FlushBytes > 0 || !syncing) {
+		return errors.New("syncing every Nth write requires write mode, a sync mode of fsync or fdatasync and no flush interval or flush bytes")
+	}
+
+	if cfg.Count < 0 {
+		return errors.New("count must not be negative")
+	}
+	if cfg.Limit < 0 {
+		return errors.New("limit must not be negative")
+	}
+	for _, p := range cfg.LimitWarn {
+		if p <= 0 || p >= 100 {
+			return fmt.Errorf("limit warning %v must be above 0 and below 100", p)
+		}
+	}
+
+	if cfg.Verify && (!write || !seekable || (cfg.Limit == 0 && cfg.Duration == 0)) {
+		return errors.New("verification requires write mode to a file and a limit or duration")
+	}
+	if cfg.Infile != "" && !write {
+		return errors.New("an input file requires write mode")
+	}
+	if cfg.CompressRatio != 0 && (cfg.CompressRatio < 1 || cfg.Infile != "") {
+		return errors.New("the compression ratio must be at least 1 and cannot be combined with an input file")
+	}
+	if cfg.Verify && cfg.Infile == "" && cfg.CompressRatio == 0 && cfg.Pattern != "zero" {
+		return fmt.Errorf("verification requires a deterministic pattern, %s is not", cfg.Pattern)
+	}
+	if cfg.Random && (!write || !seekable || cfg.Verify) {
+		return errors.New("random offsets require write mode to a file and cannot be verified")
+	}
+	if cfg.Random && cfg.Filesize < int64(cfg.Chunksize) {
+		return errors.New("random offsets require a file size of at least one chunk")
+	}
+
+	csvFile := false
+	for _, spec := range sinkSpecs(cfg) {
+		kind, path, _ := strings.Cut(spec, ":")
+		csvFile = csvFile || (kind == "csv" && path != "-")
+	}
+	if cfg.PerWorkerCSV && (!csvFile || statsToStdout || !write || len(workerPaths(cfg)) < 2) {
+		return errors.New("per worker statistics require write mode to several files and a CSV statistics file")
+	}
+	if cfg.Plot != "" && (!csvFile || statsToStdout) {
+		return errors.New("plotting requires a CSV statistics file")
+	}
+
+	if cfg.PrintEvery < 1 {
+		return errors.New("print every must be at least 1")
+	}
+	if cfg.MaxP99 < 0 || cfg.MinThroughput < 0 {
+		return errors.New("the p99 latency and throughput thresholds cannot be negative")
+	}
+
+	if cfg.Batch < 1 || cfg.Batch > maxBatch {
+		return fmt.Errorf("batch must be between 1 and %d chunks", maxBatch)
+	}
+	if cfg.Batch > 1 && (!write || cfg.QueueDepth > 1 || cfg.Random || cfg.Infile != "") {
+		return errors.New("batching requires sequential writes without a queue depth, random offsets or an input file")
+	}
+	if cfg.RWMix < 0 || cfg.RWMix > 100 {
+		return errors.New("the read/write mix must be a percentage between 0 and 100")
+	}
+	if cfg.RWMix > 0 && (!write || !seekable || cfg.Batch > 1) {
+		return errors.New("a read/write mix requires write mode to a file and no batching")
+	}
+
+	if cfg.Wrap != "none" && cfg.Wrap != "buffered" && cfg.Wrap != "gzip" {
+		return fmt.Errorf("invalid wrap %q, must be none, buffered or gzip", cfg.Wrap)
+	}
+	if cfg.Wrap != "none" && (!write || cfg.QueueDepth > 1 || cfg.Random || cfg.Batch > 1 || cfg.RWMix > 0 || cfg.Direct || cfg.FlushInterval > 0) {
+		return errors.New("a wrapper requires sequential writes without a queue depth, random offsets, batching, a read/write mix, direct I/O or a flush interval")
+	}
+	if cfg.Wrap == "gzip" && cfg.Verify {
+		return errors.New("compressed output cannot be verified")
+	}
+	if cfg.WrapSize < 1 {
+		return errors.New("wrap size must be at least 1 byte")
+	}
+	if cfg.Checksum != "none" && cfg.Checksum != "crc32" && cfg.Checksum != "sha256" {
+		return fmt.Errorf("invalid checksum %q, must be none, crc32 or sha256", cfg.Checksum)
+	}
+	if cfg.Checksum != "none" && !write {
+		return errors.New("a checksum requires write mode")
+	}
+
+	if cfg.SparseRatio < 0 || cfg.SparseRatio >= 1 {
+		return errors.New("the sparse ratio must be at least 0 and below 1")
+	}
+	if cfg.SparseRatio > 0 && (!write || !seekable || cfg.Random || cfg.Batch > 1 || cfg.Verify || cfg.Wrap != "none") {
+		return errors.New("sparse writes require write mode to a file without random offsets, batching, verification or a wrapper")
+	}
+	if cfg.IOURing && (!write || !seekable || cfg.Infile != "" || cfg.RWMix > 0 || cfg.Batch > 1 || cfg.Wrap != "none" || cfg.RetryENOSPC) {
+		return errors.New("io_uring requires write mode to a file without an input file, a read/write mix, batching, a wrapper or ENOSPC retries")
+	}
+	if cfg.ProgressFD < 0 || (cfg.ProgressFD > 0 && cfg.ProgressFD <= 2) {
+		return errors.New("the progress fd must be 3 or above, stdin, stdout and stderr are taken")
+	}
+	if cfg.Device != "" && (!write || !seekable || cfg.Listen != "") {
+		return errors.New("write amplification requires write mode to a file")
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package throughput
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  Config
+		want string
+	}{
+		{"defaults", Config{Outfile: "out.dat"}, ""},
+		{"discard", Config{Discard: true}, ""},
+		{"listen", Config{Listen: ":0"}, ""},
+		{"no target", Config{}, "output file required"},
+		{"negative chunksize", Config{Outfile: "out.dat", Chunksize: -1}, "chunksize must be positive"},
+		{"huge chunksize", Config{Outfile: "out.dat", Chunksize: maxChunksize + 1}, "must not exceed"},
+		{"negative interval", Config{Outfile: "out.dat", IntervalMs: -time.Second}, "interval must be positive"},
+		{"subsample", Config{Outfile: "out.dat", Subsample: time.Second}, "subsample must be shorter"},
+		{"subsample multiple", Config{Outfile: "out.dat", Subsample: 50 * time.Millisecond}, ""},
+		{"subsample not a multiple", Config{Outfile: "out.dat", IntervalMs: 250 * time.Millisecond, Subsample: 100 * time.Millisecond}, "must be a multiple"},
+		{"mode", Config{Outfile: "out.dat", Mode: "append"}, "invalid mode"},
+		{"sync mode", Config{Outfile: "out.dat", SyncMode: "sync"}, "invalid sync mode"},
+		{"negative workers", Config{Outfile: "out.dat", Workers: -1}, "worker"},
+		{"read queue depth", Config{Outfile: "out.dat", Mode: "read", QueueDepth: 4}, "queue depth above 1"},
+		{"stdout workers", Config{Outfile: "-", Workers: 2}, "writing to stdout"},
+		{"prealloc without limit", Config{Outfile: "out.dat", Prealloc: true}, "preallocation"},
+		{"batch", Config{Outfile: "out.dat", Batch: 2048}, "batch must be between"},
+		{"random filesize", Config{Outfile: "out.dat", Random: true}, "file size"},
+		{"verify pattern", Config{Outfile: "out.dat", Verify: true, Limit: 1 << 20, Pattern: "random"}, "deterministic pattern"},
+		{"flush without sync", Config{Outfile: "out.dat", SyncMode: "none", FlushBytes: 1 << 20}, "flush"},
+		{"progress fd", Config{Outfile: "out.dat", ProgressFD: 2}, "progress fd"},
+		{"discard with file", Config{Discard: true, Outfile: "out.dat"}, "no output file"},
+		{"truncate overwrite", Config{Outfile: "out.dat", Truncate: true, OpenMode: "overwrite"}, "truncating"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.cfg.Validate()
+			if tt.want == "" {
+				if err != nil {
+					t.Errorf("got %q, want no error", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("got %v, want an error containing %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package throughput
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Describe prints what a run with this configuration would do, without
+// opening any files.
+func (cfg Config) Describe(w io.Writer) {
+	targets := strings.Join(workerPaths(cfg), ", ")
+	if cfg.Listen != "" {
+		targets = fmt.Sprintf("%d connection(s) accepted on %s", cfg.Workers, cfg.Listen)
+	}
+
+	syncMode := cfg.SyncMode
+	switch {
+	case cfg.OSync:
+		syncMode = "O_SYNC"
+	case cfg.ODSync:
+		syncMode = "O_DSYNC"
+	}
+
+	fmt.Fprintln(w, "Dry run, nothing is written:")
+	fmt.Fprintf(w, "  Mode:       %s\n", cfg.Mode)
+	fmt.Fprintf(w, "  Targets:    %s\n", targets)
+	fmt.Fprintf(w, "  Chunksize:  %s\n", formatBytes(int64(cfg.Chunksize)))
+	if cfg.Mode != "read" && cfg.Listen == "" {
+		fmt.Fprintf(w, "  Open mode:  %s\n", cfg.openMode())
+	}
+	fmt.Fprintf(w, "  Sync:       %s\n", syncMode)
+	fmt.Fprintf(w, "  Direct I/O: %t\n", cfg.Direct)
+	if cfg.Wrap != "" && cfg.Wrap != "none" {
+		fmt.Fprintf(w, "  Wrapper:    %s\n", cfg.Wrap)
+	}
+	fmt.Fprintf(w, "  Workers:    %d (queue depth %d)\n", cfg.Workers, max(cfg.QueueDepth, 1))
+	if cfg.IOURing {
+		fmt.Fprintln(w, "  Backend:    io_uring")
+	}
+	fmt.Fprintf(w, "  Limit:      %s\n", describeLimit(cfg))
+	fmt.Fprintf(w, "  Volume:     %s\n", describeVolume(cfg))
+}
+
+func describeLimit(cfg Config) string {
+	var limits []string
+	if cfg.Limit > 0 {
+		limits = append(limits, formatBytes(cfg.Limit))
+	}
+	if cfg.Duration > 0 {
+		limits = append(limits, cfg.Duration.String())
+	}
+	if cfg.Count > 0 {
+		limits = append(limits, fmt.Sprintf("%d calls", cfg.Count))
+	}
+	if len(limits) == 0 {
+		return "none, runs until interrupted"
+	}
+	return strings.Join(limits, " or ")
+}
+
+func describeVolume(cfg Config) string {
+	volume := cfg.Volume()
+	if volume == 0 {
+		return "unknown"
+	}
+	return "up to " + formatBytes(volume)
+}
+
+// Volume returns the most a run writes as far as the configuration tells,
+// 0 if it is unbounded.
+func (cfg Config) Volume() int64 {
+	volume := cfg.Limit
+	if cfg.Count > 0 {
+		byCount := int64(cfg.Count) * int64(cfg.Chunksize) * int64(max(cfg.Batch, 1))
+		if volume == 0 || byCount < volume {
+			volume = byCount
+		}
+	}
+	if cfg.Rate > 0 && cfg.Duration > 0 {
+		byRate := int64(cfg.Rate * 1024 * 1024 * cfg.Duration.Seconds())
+		if volume == 0 || byRate < volume {
+			volume = byRate
+		}
+	}
+	return volume
+}
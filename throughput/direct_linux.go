@@ -0,0 +1,7 @@
+//go:build linux
+
+package throughput
+
+import "syscall"
+
+const directFlag = syscall.O_DIRECT
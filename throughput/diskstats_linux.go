@@ -0,0 +1,57 @@
+//go:build linux
+
+package throughput
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// Returns the sysfs statistics file of the block device name, with "auto"
+// the one of the device holding f.
+func diskStatFile(name string, f *os.File) (string, error) {
+	if name != "auto" {
+		path := filepath.Join("/sys/class/block", filepath.Base(name), "stat")
+		if _, err := os.Stat(path); err != nil {
+			return "", fmt.Errorf("no block device %s", name)
+		}
+		return path, nil
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return "", fmt.Errorf("no device of %s", f.Name())
+	}
+	dev := st.Dev
+	if info.Mode()&os.ModeDevice != 0 && info.Mode()&os.ModeCharDevice == 0 {
+		dev = st.Rdev
+	}
+	major := (dev>>8)&0xfff | (dev>>32)&^0xfff
+	minor := dev&0xff | (dev>>12)&^0xff
+	path := fmt.Sprintf("/sys/dev/block/%d:%d/stat", major, minor)
+	if _, err := os.Stat(path); err != nil {
+		return "", fmt.Errorf("%s is not on a block device (%d:%d), pass its name to -device", f.Name(), major, minor)
+	}
+	return path, nil
+}
+
+// The seventh field counts the sectors written, always of 512 bytes.
+func sectorsWritten(path string) (int64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) < 7 {
+		return 0, fmt.Errorf("unexpected format of %s", path)
+	}
+	return strconv.ParseInt(fields[6], 10, 64)
+}
@@ -0,0 +1,16 @@
+//go:build !linux
+
+package throughput
+
+import (
+	"errors"
+	"os"
+)
+
+func diskStatFile(name string, f *os.File) (string, error) {
+	return "", errors.ErrUnsupported
+}
+
+func sectorsWritten(path string) (int64, error) {
+	return 0, errors.ErrUnsupported
+}
@@ -0,0 +1,7 @@
+//go:build linux
+
+package throughput
+
+import "syscall"
+
+const dsyncFlag = syscall.O_DSYNC
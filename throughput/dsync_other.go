@@ -0,0 +1,5 @@
+//go:build !linux
+
+package throughput
+
+const dsyncFlag = 0
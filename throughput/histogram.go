@@ -0,0 +1,57 @@
+package throughput
+
+import (
+	"encoding/csv"
+	"fmt"
+	"math/bits"
+	"os"
+	"time"
+)
+
+// Counts latencies in power-of-two microsecond buckets: bucket 0 holds
+// everything below 1µs, bucket i everything in [2^(i-1), 2^i) µs.
+type histogram [64]uint64
+
+func (h *histogram) add(latency time.Duration) {
+	us := uint64(max(latency.Microseconds(), 0))
+	h[bits.Len64(us)]++
+}
+
+func bucketBounds(i int) (lower, upper uint64) {
+	if i == 0 {
+		return 0, 1
+	}
+	return 1 << (i - 1), 1 << i
+}
+
+// Buckets outside the observed range are left out.
+func (h *histogram) write(path string) error {
+	first, last := -1, -1
+	for i, n := range h {
+		if n > 0 {
+			if first < 0 {
+				first = i
+			}
+			last = i
+		}
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	w := csv.NewWriter(file)
+	w.Write([]string{"lower_us", "upper_us", "count"})
+	for i := first; i >= 0 && i <= last; i++ {
+		lower, upper := bucketBounds(i)
+		w.Write([]string{fmt.Sprint(lower), fmt.Sprint(upper), fmt.Sprint(h[i])})
+	}
+	w.Flush()
+
+	if err := w.Error(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
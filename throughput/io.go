@@ -0,0 +1,882 @@
+package throughput
+
+import (
+	crand "crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand"
+	"os"
+	"sync/atomic"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// With a limit set, every worker claims its next chunk up front, so
+// concurrent workers together never transfer more than the limit.
+// The same goes for -count, which claims one call per chunk.
+func (a *App) chunk(size int) int {
+	if a.cfg.Limit == 0 && a.cfg.Count == 0 {
+		return size
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.cfg.Count > 0 {
+		if !a.warming && a.claimedCalls >= a.cfg.Count {
+			return 0
+		}
+		a.claimedCalls++
+	}
+
+	if a.cfg.Limit > 0 {
+		remaining := a.cfg.Limit - a.claimed
+		if !a.warming && remaining < int64(size) {
+			size = int(remaining)
+		}
+		a.claimed += int64(size)
+	}
+
+	return size
+}
+
+func (a *App) release(n int) {
+	if a.cfg.Limit == 0 || n == 0 {
+		return
+	}
+
+	a.mu.Lock()
+	a.claimed -= int64(n)
+	a.mu.Unlock()
+}
+
+func (a *App) limitReached() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.warming {
+		return false
+	}
+	return (a.cfg.Limit > 0 && a.stats.WrittenBytesTotal >= a.cfg.Limit) ||
+		(a.cfg.Count > 0 && a.stats.Calls >= a.cfg.Count)
+}
+
+// Inputs that fit into a chunk are tiled into the buffer once. Larger ones
+// stay open and are streamed, see content.
+func loadInfile(path string, data []byte) (*os.File, int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, 0, err
+	}
+	if info.Size() == 0 {
+		file.Close()
+		return nil, 0, fmt.Errorf("%s is empty", path)
+	}
+
+	if info.Size() > int64(len(data)) {
+		return file, info.Size(), nil
+	}
+
+	defer file.Close()
+	content := make([]byte, info.Size())
+	if _, err := io.ReadFull(file, content); err != nil {
+		return nil, 0, err
+	}
+	for i := 0; i < len(data); i += len(content) {
+		copy(data[i:], content)
+	}
+
+	return nil, 0, nil
+}
+
+// Fills buf with the data belonging at pos bytes into a worker's region.
+// Streamed input files are cycled, so the content only depends on the
+// position and stays the same with several writes in flight.
+func (a *App) content(source *os.File, buf []byte, pos int64) error {
+	if source == nil {
+		copy(buf, a.data)
+		return nil
+	}
+
+	for n := 0; n < len(buf); {
+		read, err := source.ReadAt(buf[n:], (pos+int64(n))%a.srcsize)
+		n += read
+		if err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Splits size bytes into slices of data, with -batch one write covers
+// several chunks that all point into the same buffer.
+func vectors(bufs [][]byte, data []byte, size int) [][]byte {
+	for size > 0 {
+		n := min(size, len(data))
+		bufs = append(bufs, data[:n])
+		size -= n
+	}
+	return bufs
+}
+
+// Drops the first n bytes from bufs.
+func advance(bufs [][]byte, n int) [][]byte {
+	for n > 0 && len(bufs) > 0 {
+		if n < len(bufs[0]) {
+			bufs[0] = bufs[0][n:]
+			return bufs
+		}
+		n -= len(bufs[0])
+		bufs = bufs[1:]
+	}
+	return bufs
+}
+
+func (a *App) writeChunk(w *worker, bufs [][]byte, offset int64) (int, error) {
+	if a.cfg.Discard {
+		n := 0
+		for _, buf := range bufs {
+			n += len(buf)
+		}
+		return n, nil
+	}
+	if w.wrap != nil {
+		return w.wrap.Write(bufs[0])
+	}
+	if len(bufs) > 1 {
+		return writev(w.file, bufs, &w.iovecs)
+	}
+	if a.cfg.QueueDepth > 1 || a.cfg.Random || a.cfg.SparseRatio > 0 {
+		return w.file.WriteAt(bufs[0], offset)
+	}
+	return w.file.Write(bufs[0])
+}
+
+// Write calls by the share of the requested bytes the kernel accepted, in
+// quarters, the last bucket counts the complete ones.
+type writeSizes [5]int
+
+func (s *writeSizes) add(n, requested int) {
+	if n >= requested {
+		s[4]++
+		return
+	}
+	s[n*4/requested]++
+}
+
+func (s writeSizes) partial() int {
+	return s[0] + s[1] + s[2] + s[3]
+}
+
+// Short writes are retried until the whole chunk is written, the latency
+// covers all attempts.
+func (a *App) write(w *worker, bufs [][]byte, size int, offset int64) (int, error) {
+	// Retrying trims bufs, the chunk they repeat stays for the checksum.
+	chunk := bufs[0]
+	start := time.Now()
+	written := 0
+	var sizes writeSizes
+	var err error
+	for written < size {
+		var n int
+		n, err = a.writeChunk(w, bufs, offset+int64(written))
+		if err == nil {
+			sizes.add(n, size-written)
+		}
+		written += n
+		bufs = advance(bufs, n)
+		if errors.Is(err, syscall.ENOSPC) && a.cfg.RetryENOSPC {
+			if !a.waitForSpace() {
+				err = nil
+				break
+			}
+			continue
+		}
+		if err != nil {
+			break
+		}
+		if written < size && !a.cfg.QuietWrites {
+			slog.Warn("short write, retrying", "file", w.file.Name(), "offset", offset+int64(written), "written", written, "size", size)
+		}
+	}
+	return a.complete(w, chunk, written, size, sizes, time.Since(start), offset, err)
+}
+
+// Accounts a finished write, synced if due, and returns the bytes written
+// or the error. The written bytes, chunk repeated, go into the checksum
+// once they are accounted.
+func (a *App) complete(w *worker, chunk []byte, written, size int, sizes writeSizes, latency time.Duration, offset int64, err error) (int, error) {
+	a.release(size - written)
+
+	var syncErr error
+	var syncTime time.Duration
+	synced := err == nil && a.syncDue(w, written)
+	if synced {
+		syncStart := time.Now()
+		syncErr = a.sync(w)
+		syncTime = time.Since(syncStart)
+	}
+
+	a.mu.Lock()
+	if a.frozen {
+		a.mu.Unlock()
+		return written, err
+	}
+	a.stats.WrittenBytes += written
+	a.stats.WrittenBytesTotal += int64(written)
+	a.stats.Calls++
+	a.stats.IntervalCalls++
+	a.stats.ShortWrites += sizes.partial()
+	for i, n := range sizes {
+		a.stats.WriteSizes[i] += n
+	}
+	w.written += int64(written)
+	w.calls++
+	a.recordLatency(latency)
+	a.stats.WriteTime += latency
+	if err != nil {
+		a.stats.Errors++
+	}
+	if synced {
+		a.stats.Syncs++
+		a.stats.SyncTime += syncTime
+	}
+	if syncErr != nil {
+		a.stats.SyncErrors++
+	}
+	a.mu.Unlock()
+
+	if err == nil {
+		a.checksum(w, chunk, written)
+	}
+
+	if err != nil {
+		slog.Error("writing data failed", "file", w.file.Name(), "offset", offset+int64(written), "err", err)
+		return written, err
+	}
+	if syncErr != nil {
+		slog.Error("syncing data failed", "file", w.file.Name(), "err", syncErr)
+		return written, fmt.Errorf("sync failed: %w", syncErr)
+	}
+
+	return written, nil
+}
+
+const enospcRetryDelay = 100 * time.Millisecond
+
+// Counts the retry and waits a moment for space to be freed, returns false
+// if the app stopped meanwhile.
+func (a *App) waitForSpace() bool {
+	a.mu.Lock()
+	a.stats.ENOSPCRetries++
+	a.mu.Unlock()
+
+	select {
+	case <-time.After(enospcRetryDelay):
+		return true
+	case <-a.stop:
+		return false
+	}
+}
+
+// Without a flush cadence every write is synced. -sync-every syncs every
+// Nth write, -flush-bytes once that many bytes were written since the last
+// sync, -flush-interval leaves the syncs to flushLoop.
+func (a *App) syncDue(w *worker, n int) bool {
+	if a.syncMode(w) == "none" {
+		return false
+	}
+	if a.cfg.FlushBytes == 0 && a.cfg.SyncEvery == 0 {
+		return a.cfg.FlushInterval == 0
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.cfg.SyncEvery > 0 {
+		w.unsyncedCalls++
+		if w.unsyncedCalls < a.cfg.SyncEvery {
+			return false
+		}
+		w.unsyncedCalls = 0
+		return true
+	}
+	w.unsynced += int64(n)
+	if w.unsynced < a.cfg.FlushBytes {
+		return false
+	}
+	w.unsynced = 0
+	return true
+}
+
+// Whatever a wrapper holds is flushed first, so the sync covers it.
+func (a *App) sync(w *worker) error {
+	if w.wrap != nil {
+		if err := w.wrap.Flush(); err != nil {
+			return err
+		}
+	}
+	switch a.syncMode(w) {
+	case "fsync":
+		return w.file.Sync()
+	case "fdatasync":
+		return fdatasync(w.file)
+	}
+	return nil
+}
+
+// Syncs every file on the -flush-interval cadence, independently of the
+// writes in flight.
+func (a *App) flushLoop() {
+	defer a.wg.Done()
+
+	ticker := time.NewTicker(a.cfg.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-a.stop:
+			return
+		}
+
+		for _, w := range a.workers {
+			if a.syncMode(w) == "none" {
+				continue
+			}
+			start := time.Now()
+			err := a.sync(w)
+			took := time.Since(start)
+
+			a.mu.Lock()
+			a.stats.Syncs++
+			a.stats.SyncTime += took
+			w.unsynced = 0
+			if err != nil {
+				a.stats.SyncErrors++
+			}
+			a.mu.Unlock()
+
+			if err != nil {
+				slog.Error("syncing data failed", "file", w.file.Name(), "err", err)
+				a.fail(fmt.Errorf("sync failed: %w", err))
+				return
+			}
+		}
+	}
+}
+
+// With O_SYNC or O_DSYNC the kernel already syncs every write.
+func (a *App) syncMode(w *worker) string {
+	if w.stream || a.cfg.OSync || a.cfg.ODSync {
+		return "none"
+	}
+	return a.cfg.SyncMode
+}
+
+// The samples go into one of two buffers of fixed capacity that
+// collectStats swaps every interval, so recording never allocates.
+func (a *App) recordLatency(latency time.Duration) {
+	if latency > a.stats.MaxLatency {
+		a.stats.MaxLatency = latency
+	}
+	a.hist.add(latency)
+	if a.cfg.MaxP99 > 0 && latency > a.cfg.MaxP99 {
+		a.stats.SlowCalls++
+	}
+	if len(a.latencies) < cap(a.latencies) {
+		a.latencies = append(a.latencies, latency)
+	}
+}
+
+func (a *App) read(w *worker, data []byte) (int, error) {
+	start := time.Now()
+	read, err := w.file.Read(data)
+	latency := time.Since(start)
+	a.release(len(data) - read)
+	if errors.Is(err, io.EOF) && w.stream {
+		return 0, io.EOF
+	} else if errors.Is(err, io.EOF) {
+		_, err = w.file.Seek(0, io.SeekStart)
+		if err != nil {
+			slog.Error("rewinding file failed", "file", w.file.Name(), "err", err)
+			return 0, err
+		}
+	} else if err != nil {
+		slog.Error("reading data failed", "file", w.file.Name(), "err", err)
+		return 0, err
+	}
+
+	a.mu.Lock()
+	a.stats.WrittenBytes += read
+	a.stats.WrittenBytesTotal += int64(read)
+	a.stats.Calls++
+	a.stats.IntervalCalls++
+	a.recordLatency(latency)
+	a.mu.Unlock()
+
+	return read, nil
+}
+
+// The generator is shared by all workers, so a seed reproduces the whole
+// run.
+func (a *App) randInt63n(n int64) int64 {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.rng.Int63n(n)
+}
+
+// Leaves each chunk sized region ahead of a write as a hole with the
+// -sparse-ratio probability, returns the bytes skipped.
+func (a *App) holes() int64 {
+	if a.cfg.SparseRatio == 0 {
+		return 0
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	var n int64
+	for a.rng.Float64() < a.cfg.SparseRatio {
+		n += int64(a.cfg.Chunksize)
+	}
+	a.stats.HoleBytes += n
+	return n
+}
+
+// Picks a chunk aligned offset within the file size.
+func (a *App) randomOffset() int64 {
+	blocks := a.cfg.Filesize / int64(a.cfg.Chunksize)
+	return a.randInt63n(blocks) * int64(a.cfg.Chunksize)
+}
+
+// Holds the workers back during the idle part of a -burst duty cycle, the
+// cycles start with Run. Returns false if the app stopped while waiting.
+func (a *App) burstGate() bool {
+	if a.cfg.BurstOff == 0 {
+		return true
+	}
+
+	cycle := a.cfg.BurstOn + a.cfg.BurstOff
+	pos := time.Since(a.bursts) % cycle
+	if pos < a.cfg.BurstOn {
+		return true
+	}
+
+	select {
+	case <-time.After(cycle - pos):
+		return true
+	case <-a.stop:
+		return false
+	}
+}
+
+// The part of the file a mixed read may pick from: with -random what the
+// file held before and the chunks written since, everything written so far
+// otherwise. Preallocated space nothing was written to is left out, with
+// FALLOC_FL_KEEP_SIZE it lies beyond the end of the file and reads nothing.
+func (a *App) readable(w *worker) int64 {
+	if a.cfg.Random {
+		return min(w.end.Load(), a.cfg.Filesize)
+	}
+	return w.offset.Load()
+}
+
+// Raises v to n unless it is larger already.
+func raise(v *atomic.Int64, n int64) {
+	for old := v.Load(); n > old && !v.CompareAndSwap(old, n); old = v.Load() {
+	}
+}
+
+// Reads a chunk from a random chunk aligned offset of the readable part.
+func (a *App) mixedRead(w *worker, data []byte) (int, error) {
+	blocks := a.readable(w) / int64(a.cfg.Chunksize)
+	offset := a.randInt63n(blocks) * int64(a.cfg.Chunksize)
+
+	start := time.Now()
+	read, err := w.reader.ReadAt(data, offset)
+	latency := time.Since(start)
+	// Only writes count towards -limit, the read gives its claim back.
+	a.release(len(data))
+	if errors.Is(err, io.EOF) {
+		err = nil
+	}
+
+	a.mu.Lock()
+	a.stats.ReadBytes += read
+	a.stats.ReadBytesTotal += int64(read)
+	a.stats.Calls++
+	a.stats.IntervalCalls++
+	a.recordLatency(latency)
+	a.mu.Unlock()
+
+	if err != nil {
+		slog.Error("reading data failed", "file", w.reader.Name(), "offset", offset, "err", err)
+	}
+	return read, err
+}
+
+func (a *App) stopped() bool {
+	select {
+	case <-a.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// Every chunk goes to the next file of the worker's group, which stripes
+// the writes across all output files.
+func (a *App) gatherStats(group []*worker, next int) {
+	defer a.writers.Done()
+
+	var buf []byte
+	if a.source != nil {
+		buf = newBuffer(a.cfg, a.align)
+	}
+	var bufs [][]byte
+
+	// Mixed reads get a buffer of their own, the write buffer is shared.
+	var readBuf []byte
+	if a.cfg.RWMix > 0 {
+		readBuf = newBuffer(a.cfg, a.align)
+	}
+
+	for !a.stopped() {
+		if !a.waitResumed() || !a.burstGate() {
+			return
+		}
+
+		w := group[next%len(group)]
+		next++
+
+		data := w.data
+		if buf != nil {
+			data = buf
+		}
+		size := a.chunk(len(data) * max(a.cfg.Batch, 1))
+		if size == 0 {
+			return
+		}
+		if size < len(data) {
+			data = data[:size]
+		}
+
+		var n int
+		var err error
+		if a.cfg.Mode == "read" {
+			n, err = a.read(w, data)
+			if errors.Is(err, io.EOF) {
+				a.shutdown()
+				return
+			}
+			if err != nil {
+				a.fail(fmt.Errorf("read failed: %w", err))
+				return
+			}
+		} else if readBuf != nil && a.randInt63n(100) >= int64(a.cfg.RWMix) && a.readable(w) >= int64(a.cfg.Chunksize) {
+			n, err = a.mixedRead(w, readBuf[:size])
+			if err != nil {
+				a.fail(fmt.Errorf("read failed: %w", err))
+				return
+			}
+		} else {
+			var offset int64
+			if a.cfg.Random {
+				offset = a.randomOffset()
+			} else {
+				offset = w.offset.Add(a.holes()+int64(size)) - int64(size)
+			}
+			if a.source != nil {
+				if err := a.content(a.source, data, offset-w.start); err != nil {
+					a.fail(fmt.Errorf("reading input failed: %w", err))
+					return
+				}
+			}
+
+			bufs = vectors(bufs[:0], data, size)
+			n, err = a.write(w, bufs, size, offset)
+			if err != nil {
+				a.fail(fmt.Errorf("write failed: %w", err))
+				return
+			}
+			raise(&w.end, offset+int64(n))
+		}
+
+		if a.limiter != nil && !a.limiter.wait(n, a.stop) {
+			return
+		}
+
+		if a.limitReached() {
+			a.shutdown()
+			return
+		}
+	}
+}
+
+func openFlags(cfg Config) int {
+	flags := 0
+	if cfg.Direct {
+		flags |= directFlag
+	}
+	if cfg.OSync {
+		flags |= os.O_SYNC
+	}
+	if cfg.ODSync {
+		flags |= dsyncFlag
+	}
+	return flags
+}
+
+func openInfile(path string, flags int) (*os.File, error) {
+	file, err := os.OpenFile(path, os.O_RDONLY|flags, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	if info.Size() == 0 {
+		file.Close()
+		return nil, fmt.Errorf("%s is empty, nothing to read", path)
+	}
+
+	return file, nil
+}
+
+// Regular files, devices and streams are fine, anything else such as a
+// directory only fails later with a confusing error.
+func checkTarget(path string) error {
+	if path == "-" || isTCP(path) {
+		return nil
+	}
+
+	info, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if info.IsDir() {
+		return fmt.Errorf("%s is a directory", path)
+	}
+	if !info.Mode().IsRegular() && info.Mode()&os.ModeDevice == 0 && !isStream(info) {
+		return fmt.Errorf("%s is not a regular file or device", path)
+	}
+	return nil
+}
+
+func isStream(info os.FileInfo) bool {
+	return info.Mode()&(os.ModeNamedPipe|os.ModeCharDevice|os.ModeSocket) != 0
+}
+
+func isBlockDevice(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.Mode()&os.ModeDevice != 0 && info.Mode()&os.ModeCharDevice == 0
+}
+
+// A block device has a fixed size and cannot be created, truncated or
+// appended to, it is written from its start.
+func openBlockDevice(path string, flags int) (*os.File, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|flags&^os.O_TRUNC, 0)
+	if errors.Is(err, os.ErrPermission) {
+		return nil, fmt.Errorf("writing to block device %s requires write permission on it, usually root or the disk group: %w", path, err)
+	}
+	return file, err
+}
+
+// Existing files are appended to, emptied with truncate or written from
+// their start with overwrite, new ones are created in every mode.
+func openOutfile(path string, flags int, mode string, positioned bool) (*os.File, error) {
+	if path == "-" {
+		return os.Stdout, nil
+	}
+	if isTCP(path) {
+		return dialTCP(path)
+	}
+
+	if info, err := os.Stat(path); err == nil && isStream(info) {
+		return os.OpenFile(path, os.O_WRONLY|flags, 0)
+	}
+	if isBlockDevice(path) {
+		return openBlockDevice(path, flags)
+	}
+
+	if mode == "overwrite" {
+		return os.OpenFile(path, os.O_WRONLY|os.O_CREATE|flags, 0666)
+	}
+
+	// Positioned writes are not allowed on files opened with O_APPEND, and
+	// preallocated space must not move the position appends would use.
+	if positioned {
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|flags, 0666)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := file.Seek(0, io.SeekEnd); err != nil {
+			file.Close()
+			return nil, err
+		}
+		return file, nil
+	}
+
+	return os.OpenFile(path, os.O_APPEND|os.O_WRONLY|os.O_CREATE|flags, 0666)
+}
+
+// How existing output files are opened: append, truncate or overwrite,
+// Truncate predates OpenMode.
+func (cfg Config) openMode() string {
+	if cfg.OpenMode != "" {
+		return cfg.OpenMode
+	}
+	if cfg.Truncate {
+		return "truncate"
+	}
+	return "append"
+}
+
+func checkOpenFlags(cfg Config) error {
+	if cfg.ODSync && dsyncFlag == 0 {
+		return errors.New("O_DSYNC is not supported on this platform")
+	}
+	if !cfg.Direct {
+		return nil
+	}
+	if directFlag == 0 {
+		return errors.New("direct I/O is not supported on this platform")
+	}
+	return nil
+}
+
+// Block devices report their logical block size, direct I/O on anything
+// else uses directAlignment. The largest one of all files wins.
+func directAlign(files []*os.File) int {
+	align := directAlignment
+	for _, file := range files {
+		info, err := file.Stat()
+		if err != nil || info.Mode()&os.ModeDevice == 0 || info.Mode()&os.ModeCharDevice != 0 {
+			continue
+		}
+		if size, err := logicalBlockSize(file); err == nil && size > 0 {
+			align = max(align, size)
+		}
+	}
+	return align
+}
+
+func checkAlignment(cfg Config, align int) error {
+	if cfg.Chunksize%align != 0 {
+		return fmt.Errorf("chunksize must be a multiple of %d bytes for direct I/O", align)
+	}
+	if cfg.Limit%int64(align) != 0 {
+		return fmt.Errorf("limit must be a multiple of %d bytes for direct I/O", align)
+	}
+	return nil
+}
+
+// Direct I/O requires the buffer address to be aligned as well, which
+// a plain make() does not guarantee.
+func alignedBuffer(size, align int) []byte {
+	buf := make([]byte, size+align)
+	offset := 0
+	if rem := int(uintptr(unsafe.Pointer(&buf[0])) & uintptr(align-1)); rem != 0 {
+		offset = align - rem
+	}
+	return buf[offset : offset+size : offset+size]
+}
+
+func outfiles(cfg Config) []string {
+	if len(cfg.Outfiles) == 0 {
+		return []string{cfg.Outfile}
+	}
+	return cfg.Outfiles
+}
+
+// Writers get a file each, readers all read the same file through
+// independent handles. Every writer opens its own TCP connection. With
+// several output files every worker gets one handle per file, the paths
+// are grouped by worker.
+func workerPaths(cfg Config) []string {
+	var paths []string
+	for i := range cfg.Workers {
+		for _, out := range outfiles(cfg) {
+			if cfg.Workers == 1 || cfg.Mode == "read" || isTCP(out) || cfg.Discard {
+				paths = append(paths, out)
+			} else {
+				paths = append(paths, fmt.Sprintf("%s.%d", out, i))
+			}
+		}
+	}
+	return paths
+}
+
+// Targets returns the paths a run with this configuration opens.
+func (cfg Config) Targets() []string {
+	if cfg.Listen != "" {
+		return nil
+	}
+	return workerPaths(cfg)
+}
+
+func preallocate(file *os.File, size int64) error {
+	offset, err := file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+
+	err = fallocate(file, offset, size)
+	if err == nil {
+		return nil
+	}
+
+	slog.Warn("fallocate not supported, truncating instead", "file", file.Name(), "err", err)
+	return file.Truncate(offset + size)
+}
+
+// The buffer is filled once at startup and reused for every write, so the
+// random generators never end up limiting the measured throughput.
+func fillPattern(data []byte, pattern string, rng *rand.Rand) error {
+	switch pattern {
+	case "zero":
+		return nil
+	case "random":
+		rng.Read(data)
+		return nil
+	case "incompressible":
+		_, err := crand.Read(data)
+		return err
+	}
+	return fmt.Errorf("unknown pattern %q", pattern)
+}
+
+const compressSegment = 4096
+
+// Every segment starts with random bytes and is padded with zeros, the
+// random share of 1/ratio makes the buffer compress to about ratio:1 even
+// with block based compression.
+func fillCompressible(data []byte, ratio float64, rng *rand.Rand) {
+	for start := 0; start < len(data); start += compressSegment {
+		segment := data[start:min(start+compressSegment, len(data))]
+		random := int(float64(len(segment)) / ratio)
+		rng.Read(segment[:random])
+		clear(segment[random:])
+	}
+}
+
+func newBuffer(cfg Config, align int) []byte {
+	if cfg.Direct {
+		return alignedBuffer(cfg.Chunksize, align)
+	}
+	return make([]byte, cfg.Chunksize, cfg.Chunksize)
+}
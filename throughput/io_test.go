@@ -0,0 +1,268 @@
+package throughput
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unsafe"
+)
+
+func TestPreallocateKeepsStart(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "out.dat")
+	if err := os.WriteFile(out, make([]byte, 1000), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	app, err := NewApp(Config{Outfile: out, NoCSV: true, Prealloc: true, Limit: 1 << 20, Stdout: io.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer app.Close()
+
+	if w := app.workers[0]; w.start != 1000 || w.offset.Load() != 1000 {
+		t.Errorf("worker starts at %d, offset %d, want both at the old end 1000", w.start, w.offset.Load())
+	}
+}
+
+func TestReadableRandom(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "out.dat")
+	app, err := NewApp(Config{Outfile: out, NoCSV: true, SyncMode: "none", Random: true, Filesize: 1 << 20, RWMix: 50, Stdout: io.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer app.Close()
+
+	// The preallocated but unwritten file has nothing to read yet.
+	w := app.workers[0]
+	if n := app.readable(w); n != 0 {
+		t.Errorf("readable before any write: %d, want 0", n)
+	}
+
+	// Chunks written out of order only ever move the end forward.
+	chunk := int64(65536)
+	raise(&w.end, 5*chunk)
+	raise(&w.end, 2*chunk)
+	if n := app.readable(w); n != 5*chunk {
+		t.Errorf("readable after writes up to chunk 5: %d, want %d", n, 5*chunk)
+	}
+}
+
+// Accepts at most max bytes per call, like a pipe or a full disk would.
+type shortWriter struct {
+	bytes.Buffer
+	max int
+}
+
+func (w *shortWriter) Write(p []byte) (int, error) {
+	return w.Buffer.Write(p[:min(len(p), w.max)])
+}
+
+func (w *shortWriter) Flush() error {
+	return nil
+}
+
+func TestShortWriteRetry(t *testing.T) {
+	app, err := NewApp(Config{
+		Outfile:     filepath.Join(t.TempDir(), "out.dat"),
+		NoCSV:       true,
+		SyncMode:    "none",
+		Chunksize:   4096,
+		QuietWrites: true,
+		Stdout:      io.Discard,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer app.Close()
+
+	w := app.workers[0]
+	sw := &shortWriter{max: 1000}
+	w.wrap = sw
+	n, err := app.write(w, [][]byte{w.data}, len(w.data), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n != 4096 || sw.Len() != 4096 {
+		t.Errorf("wrote %d bytes, %d arrived, want the whole chunk of 4096", n, sw.Len())
+	}
+	// 1000 of 4096, 3096, 2096 and 1096 bytes, then the last 96.
+	want := writeSizes{1, 2, 0, 1, 1}
+	if app.stats.ShortWrites != 4 || app.stats.WriteSizes != want || app.stats.Calls != 1 {
+		t.Errorf("got %d short writes, sizes %v in %d calls, want 4, %v in 1", app.stats.ShortWrites, app.stats.WriteSizes, app.stats.Calls, want)
+	}
+}
+
+func TestSyncError(t *testing.T) {
+	app, err := NewApp(Config{
+		Outfile:   filepath.Join(t.TempDir(), "out.dat"),
+		NoCSV:     true,
+		SyncMode:  "fsync",
+		Chunksize: 4096,
+		Stdout:    io.Discard,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer app.Close()
+
+	w := app.workers[0]
+	w.file.Close()
+	n, err := app.complete(w, w.data, 4096, 4096, writeSizes{4: 1}, 0, 0, nil)
+	if n != 4096 || err == nil || !strings.Contains(err.Error(), "sync failed") {
+		t.Fatalf("complete() = %d, %v, want 4096 and a sync error", n, err)
+	}
+
+	if app.stats.SyncErrors != 1 || app.stats.Errors != 0 || app.stats.Syncs != 1 {
+		t.Errorf("got %d sync errors, %d errors in %d syncs, want 1, 0 in 1", app.stats.SyncErrors, app.stats.Errors, app.stats.Syncs)
+	}
+	if app.stats.WrittenBytes != 4096 {
+		t.Errorf("counted %d bytes, want the 4096 written before the sync", app.stats.WrittenBytes)
+	}
+}
+
+func TestAlignedBuffer(t *testing.T) {
+	for _, align := range []int{512, 4096, 8192} {
+		for _, size := range []int{512, 4096, 65536} {
+			buf := alignedBuffer(size, align)
+			if addr := uintptr(unsafe.Pointer(&buf[0])); addr%uintptr(align) != 0 {
+				t.Errorf("alignedBuffer(%d, %d) starts at %#x", size, align, addr)
+			}
+			if len(buf) != size || cap(buf) != size {
+				t.Errorf("alignedBuffer(%d, %d) has length %d and capacity %d", size, align, len(buf), cap(buf))
+			}
+		}
+	}
+}
+
+func TestOpenModes(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  Config
+		want int64
+	}{
+		{"append", Config{}, 12288},
+		{"truncate", Config{OpenMode: "truncate"}, 4096},
+		{"legacy truncate", Config{Truncate: true}, 4096},
+		{"overwrite", Config{OpenMode: "overwrite"}, 8192},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := filepath.Join(t.TempDir(), "out.dat")
+			if err := os.WriteFile(out, bytes.Repeat([]byte{1}, 8192), 0666); err != nil {
+				t.Fatal(err)
+			}
+
+			cfg := tt.cfg
+			cfg.Outfile, cfg.NoCSV, cfg.SyncMode, cfg.Stdout = out, true, "none", io.Discard
+			cfg.Chunksize, cfg.Limit = 4096, 4096
+			app, err := NewApp(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := app.Run(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			if err := app.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			data, err := os.ReadFile(out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if int64(len(data)) != tt.want {
+				t.Errorf("file has %d bytes, want %d", len(data), tt.want)
+			}
+			if tt.want == 4096 && bytes.IndexByte(data, 1) >= 0 {
+				t.Error("old data survived truncating")
+			}
+		})
+	}
+}
+
+// An app writing chunks of 4 KiB, batch of them per call, to /dev/null so
+// that only the cost of the write path itself is measured.
+func newDiscardApp(tb testing.TB, batch int) *App {
+	tb.Helper()
+	app, err := NewApp(Config{
+		Outfile:   os.DevNull,
+		NoCSV:     true,
+		Chunksize: 4096,
+		Batch:     batch,
+		Stdout:    io.Discard,
+	})
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { app.Close() })
+	return app
+}
+
+func BenchmarkWrite(b *testing.B) {
+	for _, batch := range []int{1, 16} {
+		b.Run(fmt.Sprintf("batch=%d", batch), func(b *testing.B) {
+			app := newDiscardApp(b, batch)
+			w := app.workers[0]
+			size := len(w.data) * batch
+			var bufs [][]byte
+			b.SetBytes(int64(size))
+			for b.Loop() {
+				bufs = vectors(bufs[:0], w.data, size)
+				if _, err := app.write(w, bufs, size, 0); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestAllocs(t *testing.T) {
+	for _, batch := range []int{1, 16} {
+		app := newDiscardApp(t, batch)
+		w := app.workers[0]
+		size := len(w.data) * batch
+		bufs := vectors(nil, w.data, size)
+		allocs := testing.AllocsPerRun(100, func() {
+			bufs = vectors(bufs[:0], w.data, size)
+			if _, err := app.write(w, bufs, size, 0); err != nil {
+				t.Fatal(err)
+			}
+		})
+		if allocs != 0 {
+			t.Errorf("a write of batch %d allocates %v times, want none", batch, allocs)
+		}
+	}
+}
+
+func TestMixedReadsAreNotWrites(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "out.dat")
+	app, err := NewApp(Config{Outfile: out, NoCSV: true, SyncMode: "none", Chunksize: 4096, Limit: 1 << 20, RWMix: 50, Stdout: io.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := app.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	app.FinalStats()
+	stats := app.Stats()
+	if err := app.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() != 1<<20 || stats.TotalBytes != 1<<20 {
+		t.Errorf("wrote %d bytes, counted %d, want the whole limit of %d", info.Size(), stats.TotalBytes, 1<<20)
+	}
+	if stats.ReadBytes == 0 {
+		t.Error("no mixed reads counted")
+	}
+}
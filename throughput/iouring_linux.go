@@ -0,0 +1,283 @@
+//go:build linux
+
+package throughput
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"sync/atomic"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+const (
+	sysIOURingSetup = 425
+	sysIOURingEnter = 426
+
+	ioringOffSQRing = 0
+	ioringOffCQRing = 0x8000000
+	ioringOffSQEs   = 0x10000000
+
+	ioringFeatSingleMmap = 1 << 0
+	ioringEnterGetEvents = 1 << 0
+	ioringOpWrite        = 23
+)
+
+type sqringOffsets struct {
+	head, tail, ringMask, ringEntries, flags, dropped, array, resv1 uint32
+	userAddr                                                        uint64
+}
+
+type cqringOffsets struct {
+	head, tail, ringMask, ringEntries, overflow, cqes, flags, resv1 uint32
+	userAddr                                                        uint64
+}
+
+type ioUringParams struct {
+	sqEntries, cqEntries, flags, sqThreadCPU, sqThreadIdle, features, wqFd uint32
+	resv                                                                   [3]uint32
+	sqOff                                                                  sqringOffsets
+	cqOff                                                                  cqringOffsets
+}
+
+type ioUringSQE struct {
+	opcode   uint8
+	flags    uint8
+	ioprio   uint16
+	fd       int32
+	off      uint64
+	addr     uint64
+	len      uint32
+	rwFlags  uint32
+	userData uint64
+	pad      [3]uint64
+}
+
+type ioUringCQE struct {
+	userData uint64
+	res      int32
+	flags    uint32
+}
+
+// An io_uring instance with its rings mapped, used by one goroutine only.
+type ring struct {
+	fd             int
+	sqMem, cqMem   []byte
+	sqeMem         []byte
+	sqHead, sqTail *uint32
+	sqMask         uint32
+	sqArray        []uint32
+	sqes           []ioUringSQE
+	cqHead, cqTail *uint32
+	cqMask         uint32
+	cqes           []ioUringCQE
+	queued         uint32
+}
+
+func newRing(entries int) (*ring, error) {
+	var p ioUringParams
+	fd, _, errno := syscall.Syscall(sysIOURingSetup, uintptr(entries), uintptr(unsafe.Pointer(&p)), 0)
+	if errno != 0 {
+		return nil, fmt.Errorf("io_uring_setup: %w", errno)
+	}
+	r := &ring{fd: int(fd)}
+
+	sqSize := int(p.sqOff.array + p.sqEntries*4)
+	cqSize := int(p.cqOff.cqes + p.cqEntries*uint32(unsafe.Sizeof(ioUringCQE{})))
+	if p.features&ioringFeatSingleMmap != 0 {
+		sqSize = max(sqSize, cqSize)
+	}
+
+	var err error
+	prot, flags := syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED|syscall.MAP_POPULATE
+	if r.sqMem, err = syscall.Mmap(r.fd, ioringOffSQRing, sqSize, prot, flags); err != nil {
+		r.close()
+		return nil, err
+	}
+	r.cqMem = r.sqMem
+	if p.features&ioringFeatSingleMmap == 0 {
+		if r.cqMem, err = syscall.Mmap(r.fd, ioringOffCQRing, cqSize, prot, flags); err != nil {
+			r.close()
+			return nil, err
+		}
+	}
+	if r.sqeMem, err = syscall.Mmap(r.fd, ioringOffSQEs, int(p.sqEntries)*int(unsafe.Sizeof(ioUringSQE{})), prot, flags); err != nil {
+		r.close()
+		return nil, err
+	}
+
+	r.sqHead = (*uint32)(unsafe.Pointer(&r.sqMem[p.sqOff.head]))
+	r.sqTail = (*uint32)(unsafe.Pointer(&r.sqMem[p.sqOff.tail]))
+	r.sqMask = *(*uint32)(unsafe.Pointer(&r.sqMem[p.sqOff.ringMask]))
+	r.sqArray = unsafe.Slice((*uint32)(unsafe.Pointer(&r.sqMem[p.sqOff.array])), p.sqEntries)
+	r.sqes = unsafe.Slice((*ioUringSQE)(unsafe.Pointer(&r.sqeMem[0])), p.sqEntries)
+	r.cqHead = (*uint32)(unsafe.Pointer(&r.cqMem[p.cqOff.head]))
+	r.cqTail = (*uint32)(unsafe.Pointer(&r.cqMem[p.cqOff.tail]))
+	r.cqMask = *(*uint32)(unsafe.Pointer(&r.cqMem[p.cqOff.ringMask]))
+	r.cqes = unsafe.Slice((*ioUringCQE)(unsafe.Pointer(&r.cqMem[p.cqOff.cqes])), p.cqEntries)
+	return r, nil
+}
+
+// Queues a positioned write, submitted by the next enter. The buffer has
+// to stay untouched until its completion is reaped.
+func (r *ring) queueWrite(fd uintptr, buf []byte, offset int64, tag uint64) {
+	tail := *r.sqTail
+	idx := tail & r.sqMask
+	r.sqes[idx] = ioUringSQE{
+		opcode:   ioringOpWrite,
+		fd:       int32(fd),
+		off:      uint64(offset),
+		addr:     uint64(uintptr(unsafe.Pointer(&buf[0]))),
+		len:      uint32(len(buf)),
+		userData: tag,
+	}
+	r.sqArray[idx] = idx
+	atomic.StoreUint32(r.sqTail, tail+1)
+	r.queued++
+}
+
+// Submits the queued writes and waits until at least wait have completed.
+// The kernel may consume fewer entries than queued, the rest is submitted
+// again so no write is left waiting in the ring.
+func (r *ring) enter(wait int) error {
+	for {
+		n, _, errno := syscall.Syscall6(sysIOURingEnter, uintptr(r.fd), uintptr(r.queued), uintptr(wait), ioringEnterGetEvents, 0, 0)
+		if errno == syscall.EINTR {
+			continue
+		}
+		if errno != 0 {
+			return fmt.Errorf("io_uring_enter: %w", errno)
+		}
+		if n == 0 && r.queued > 0 {
+			return fmt.Errorf("io_uring_enter: none of %d writes submitted", r.queued)
+		}
+		r.queued -= uint32(n)
+		if r.queued == 0 {
+			return nil
+		}
+	}
+}
+
+func (r *ring) reap(done func(tag uint64, res int32)) {
+	head := *r.cqHead
+	for tail := atomic.LoadUint32(r.cqTail); head != tail; head++ {
+		cqe := r.cqes[head&r.cqMask]
+		done(cqe.userData, cqe.res)
+	}
+	atomic.StoreUint32(r.cqHead, head)
+}
+
+func (r *ring) close() error {
+	if r.sqeMem != nil {
+		syscall.Munmap(r.sqeMem)
+	}
+	if r.cqMem != nil && &r.cqMem[0] != &r.sqMem[0] {
+		syscall.Munmap(r.cqMem)
+	}
+	if r.sqMem != nil {
+		syscall.Munmap(r.sqMem)
+	}
+	return syscall.Close(r.fd)
+}
+
+// Keeps up to -qdepth writes of the shared pattern buffer in flight on the
+// worker's ring and accounts every completion like a synchronous write.
+// Once stopped or at the limit, the writes in flight are still reaped.
+func (a *App) uringLoop(w *worker) {
+	defer a.writers.Done()
+
+	type write struct {
+		start  time.Time
+		size   int
+		offset int64
+		done   int
+		sizes  writeSizes
+	}
+	depth := max(a.cfg.QueueDepth, 1)
+	writes := make([]write, depth)
+	free := make([]uint64, 0, depth)
+	for i := range depth {
+		free = append(free, uint64(i))
+	}
+	draining := false
+
+	for {
+		for !draining && len(free) > 0 {
+			if a.stopped() || !a.waitResumed() || !a.burstGate() {
+				draining = true
+				break
+			}
+			size := a.chunk(len(w.data))
+			if size == 0 {
+				draining = true
+				break
+			}
+
+			var offset int64
+			if a.cfg.Random {
+				offset = a.randomOffset()
+			} else {
+				offset = w.offset.Add(a.holes()+int64(size)) - int64(size)
+			}
+			tag := free[len(free)-1]
+			free = free[:len(free)-1]
+			writes[tag] = write{start: time.Now(), size: size, offset: offset}
+			w.ring.queueWrite(w.file.Fd(), w.data[:size], offset, tag)
+		}
+
+		if len(free) == depth {
+			return
+		}
+		if err := w.ring.enter(1); err != nil {
+			a.fail(fmt.Errorf("write failed: %w", err))
+			return
+		}
+
+		var failed error
+		w.ring.reap(func(tag uint64, res int32) {
+			wr := &writes[tag]
+
+			var err error
+			switch {
+			case res < 0:
+				err = syscall.Errno(-res)
+			case res == 0 && wr.done < wr.size:
+				err = io.ErrShortWrite
+			default:
+				wr.sizes.add(int(res), wr.size-wr.done)
+				wr.done += int(res)
+			}
+
+			// The offsets of later chunks already account for this one, so
+			// the rest of a short write is resubmitted right behind it
+			// rather than leaving a hole.
+			if err == nil && wr.done < wr.size {
+				if !a.cfg.QuietWrites {
+					slog.Warn("short write, retrying", "file", w.file.Name(), "offset", wr.offset+int64(wr.done), "written", wr.done, "size", wr.size)
+				}
+				w.ring.queueWrite(w.file.Fd(), w.data[wr.done:wr.size], wr.offset+int64(wr.done), tag)
+				return
+			}
+
+			free = append(free, tag)
+			n, err := a.complete(w, w.data, wr.done, wr.size, wr.sizes, time.Since(wr.start), wr.offset, err)
+			if err != nil && failed == nil {
+				failed = err
+			}
+			if a.limiter != nil && !a.limiter.wait(n, a.stop) {
+				draining = true
+			}
+		})
+
+		if failed != nil {
+			a.fail(fmt.Errorf("write failed: %w", failed))
+			draining = true
+		}
+		if a.limitReached() {
+			a.shutdown()
+			draining = true
+		}
+	}
+}
@@ -0,0 +1,19 @@
+//go:build !linux
+
+package throughput
+
+import "errors"
+
+type ring struct{}
+
+func newRing(entries int) (*ring, error) {
+	return nil, errors.ErrUnsupported
+}
+
+func (r *ring) close() error {
+	return nil
+}
+
+func (a *App) uringLoop(w *worker) {
+	defer a.writers.Done()
+}
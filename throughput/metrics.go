@@ -0,0 +1,46 @@
+package throughput
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+// Serves the statistics in the Prometheus text format, so live runs can be
+// scraped instead of tailing the statistics file.
+func (a *App) serveMetrics(listener net.Listener) *http.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", a.metricsHandler)
+
+	server := &http.Server{Handler: mux}
+	go server.Serve(listener)
+	return server
+}
+
+func (a *App) metricsHandler(w http.ResponseWriter, r *http.Request) {
+	a.mu.Lock()
+	stats := a.stats
+	a.mu.Unlock()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	fmt.Fprintln(w, "# HELP grufput_written_bytes_total Bytes transferred since the start of the measurement.")
+	fmt.Fprintln(w, "# TYPE grufput_written_bytes_total counter")
+	fmt.Fprintf(w, "grufput_written_bytes_total %d\n", stats.WrittenBytesTotal)
+	fmt.Fprintln(w, "# HELP grufput_throughput_mbytes Throughput of the last interval in MByte/s.")
+	fmt.Fprintln(w, "# TYPE grufput_throughput_mbytes gauge")
+	fmt.Fprintf(w, "grufput_throughput_mbytes %f\n", stats.LastMBytes)
+	fmt.Fprintln(w, "# HELP grufput_write_errors_total Failed transfers.")
+	fmt.Fprintln(w, "# TYPE grufput_write_errors_total counter")
+	fmt.Fprintf(w, "grufput_write_errors_total %d\n", stats.Errors)
+	fmt.Fprintln(w, "# HELP grufput_sync_errors_total Failed syncs.")
+	fmt.Fprintln(w, "# TYPE grufput_sync_errors_total counter")
+	fmt.Fprintf(w, "grufput_sync_errors_total %d\n", stats.SyncErrors)
+}
+
+func stopMetrics(server *http.Server) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	server.Shutdown(ctx)
+}
@@ -0,0 +1,20 @@
+package throughput
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMetricsSyncErrors(t *testing.T) {
+	a := &App{stats: Statistics{WrittenBytesTotal: 4096, Errors: 1, SyncErrors: 3}}
+	rec := httptest.NewRecorder()
+	a.metricsHandler(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	body := rec.Body.String()
+	for _, want := range []string{"grufput_written_bytes_total 4096\n", "grufput_write_errors_total 1\n", "grufput_sync_errors_total 3\n"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics lack %q:\n%s", want, body)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package throughput
+
+import (
+	"log/slog"
+	"net"
+	"os"
+	"strings"
+)
+
+func isTCP(path string) bool {
+	return strings.HasPrefix(path, "tcp://")
+}
+
+// The connection is turned into a file, so the socket is written like any
+// other stream and syncing is skipped.
+func dialTCP(path string) (*os.File, error) {
+	conn, err := net.Dial("tcp", strings.TrimPrefix(path, "tcp://"))
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	return conn.(*net.TCPConn).File()
+}
+
+// Accepts one connection per worker, those are read until the sender
+// closes them.
+func listenTCP(addr string, n int) ([]*os.File, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	defer listener.Close()
+
+	slog.Info("listening", "addr", listener.Addr().String())
+
+	var files []*os.File
+	for range n {
+		conn, err := listener.Accept()
+		if err == nil {
+			var file *os.File
+			file, err = conn.(*net.TCPConn).File()
+			conn.Close()
+			files = append(files, file)
+		}
+		if err != nil {
+			for _, f := range files {
+				f.Close()
+			}
+			return nil, err
+		}
+	}
+	return files, nil
+}
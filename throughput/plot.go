@@ -0,0 +1,96 @@
+package throughput
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Plots the throughput over the elapsed time, columns 2 and 3 of the CSV,
+// leaving out the final row with its note. The header row, if any, is
+// skipped through columnhead.
+const gnuplotScript = `set terminal pngcairo size 1200,600
+set output %q
+set datafile separator ","
+%sset xlabel "Elapsed (s)"
+set ylabel "Throughput (MByte/s)"
+set grid
+plot %q using 2:(strcol(15) eq "" ? $3 : 1/0) with lines title "throughput"
+`
+
+const matplotlibScript = `import csv
+
+import matplotlib
+
+matplotlib.use("Agg")
+import matplotlib.pyplot as plt
+
+output, stats = %q, %q
+fieldnames = %s
+
+elapsed, mbytes = [], []
+with open(stats, newline="") as f:
+    for row in csv.DictReader(f, fieldnames=fieldnames):
+        if not row["note"]:
+            elapsed.append(float(row["elapsed_seconds"]))
+            mbytes.append(float(row["throughput_mbytes"]))
+
+plt.figure(figsize=(12, 6))
+plt.plot(elapsed, mbytes, label="throughput")
+plt.xlabel("Elapsed (s)")
+plt.ylabel("Throughput (MByte/s)")
+plt.grid(True)
+plt.legend()
+plt.savefig(output)
+`
+
+// Writes a script next to every CSV statistics file that renders it to a
+// PNG of the same name.
+func (a *App) writePlots() {
+	a.statsMu.Lock()
+	var paths []string
+	for _, sink := range a.sinks {
+		if f, ok := sink.(*fileSink); ok && f.format == "csv" && f.file != os.Stdout {
+			paths = append(paths, f.file.Name())
+		}
+	}
+	a.statsMu.Unlock()
+
+	for _, path := range paths {
+		script, err := writePlot(path, a.cfg.Plot, !a.cfg.NoHeader)
+		if err != nil {
+			slog.Error("writing plot script failed", "file", path, "err", err)
+			continue
+		}
+		slog.Info("plot script written", "file", script)
+	}
+}
+
+// Without a header row the scripts take the columns by position.
+func writePlot(csvPath, kind string, header bool) (string, error) {
+	csvPath, err := filepath.Abs(csvPath)
+	if err != nil {
+		return "", err
+	}
+	base := strings.TrimSuffix(csvPath, filepath.Ext(csvPath))
+
+	var text string
+	script := base + ".plt"
+	if kind == "matplotlib" {
+		script = base + ".py"
+		fieldnames := "None"
+		if !header {
+			fieldnames = fmt.Sprintf(`["%s"]`, strings.Join(csvHeader, `", "`))
+		}
+		text = fmt.Sprintf(matplotlibScript, base+".png", csvPath, fieldnames)
+	} else {
+		columnhead := ""
+		if header {
+			columnhead = "set key autotitle columnhead\n"
+		}
+		text = fmt.Sprintf(gnuplotScript, base+".png", columnhead, csvPath)
+	}
+	return script, os.WriteFile(script, []byte(text), 0666)
+}
@@ -0,0 +1,38 @@
+package throughput
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWritePlotHeader(t *testing.T) {
+	for _, header := range []bool{true, false} {
+		csvPath := filepath.Join(t.TempDir(), "stats.csv")
+
+		script, err := writePlot(csvPath, "gnuplot", header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		text, err := os.ReadFile(script)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(string(text), "columnhead") != header {
+			t.Errorf("header %t: gnuplot script\n%s", header, text)
+		}
+
+		script, err = writePlot(csvPath, "matplotlib", header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		text, err = os.ReadFile(script)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(string(text), "fieldnames = None") != header {
+			t.Errorf("header %t: matplotlib script\n%s", header, text)
+		}
+	}
+}
@@ -0,0 +1,14 @@
+//go:build linux
+
+package throughput
+
+import (
+	"os"
+	"syscall"
+)
+
+const fallocKeepSize = 0x01
+
+func fallocate(f *os.File, offset, size int64) error {
+	return syscall.Fallocate(int(f.Fd()), fallocKeepSize, offset, size)
+}
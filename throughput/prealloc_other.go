@@ -0,0 +1,12 @@
+//go:build !linux
+
+package throughput
+
+import (
+	"errors"
+	"os"
+)
+
+func fallocate(f *os.File, offset, size int64) error {
+	return errors.ErrUnsupported
+}
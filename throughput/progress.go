@@ -0,0 +1,66 @@
+package throughput
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// An event written to -progress-fd, one JSON object per line. Every
+// interval is reported as
+//
+//	{"event":"interval","elapsed":1.25,"bytes":104857600,"mbytes":80.12,"iops":1281.9,"p99_us":950}
+//
+// with the bytes written so far, and the end of the run as
+//
+//	{"event":"done","elapsed":10.02,"bytes":838860800,"mbytes":79.84,"iops":1277.4}
+//
+// with an "error" field if the run failed.
+type progressEvent struct {
+	Event   string  `json:"event"`
+	Elapsed float64 `json:"elapsed"`
+	Bytes   int64   `json:"bytes"`
+	MBytes  float64 `json:"mbytes"`
+	IOPS    float64 `json:"iops"`
+	P99     int64   `json:"p99_us,omitempty"`
+	Error   string  `json:"error,omitempty"`
+}
+
+type progressSink struct {
+	file *os.File
+	json *json.Encoder
+}
+
+func newProgressSink(fd int) (*progressSink, error) {
+	file := os.NewFile(uintptr(fd), fmt.Sprintf("fd %d", fd))
+	if _, err := file.Stat(); err != nil {
+		return nil, fmt.Errorf("invalid progress fd %d: %w", fd, err)
+	}
+	return &progressSink{file: file, json: json.NewEncoder(file)}, nil
+}
+
+func (s *progressSink) Record(r Sample) error {
+	event := progressEvent{
+		Event:   "interval",
+		Elapsed: r.Elapsed,
+		Bytes:   r.total,
+		MBytes:  r.MBytes,
+		IOPS:    r.IOPS,
+	}
+	if r.Note != "" {
+		event.Event = "done"
+		event.Error = strings.TrimPrefix(r.Note, "Error: ")
+		if r.Note == "End" {
+			event.Error = ""
+		}
+	}
+	if r.Latency != nil {
+		event.P99 = r.Latency.P99
+	}
+	return s.json.Encode(event)
+}
+
+func (s *progressSink) Close() error {
+	return s.file.Close()
+}
@@ -0,0 +1,57 @@
+package throughput
+
+import (
+	"sync"
+	"time"
+)
+
+type rateLimiter struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// The bucket holds at most 100ms worth of bytes (but at least one chunk),
+// which smooths out bursts without starving large writes.
+func newRateLimiter(mbytes float64, chunksize int) *rateLimiter {
+	rate := mbytes * 1024 * 1024
+	burst := rate / 10
+	if burst < float64(chunksize) {
+		burst = float64(chunksize)
+	}
+
+	return &rateLimiter{
+		rate:  rate,
+		burst: burst,
+		last:  time.Now(),
+	}
+}
+
+// Takes n bytes from the bucket and sleeps off the deficit, returns false
+// if stop was closed meanwhile.
+func (l *rateLimiter) wait(n int, stop <-chan struct{}) bool {
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+	l.tokens -= float64(n)
+	deficit := -l.tokens
+	l.mu.Unlock()
+
+	if deficit <= 0 {
+		return true
+	}
+	timer := time.NewTimer(time.Duration(deficit / l.rate * float64(time.Second)))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-stop:
+		return false
+	}
+}
@@ -0,0 +1,41 @@
+package throughput
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	const chunk = 64 << 10
+	l := newRateLimiter(1, chunk)
+	stop := make(chan struct{})
+
+	start := time.Now()
+	total := 0
+	for time.Since(start) < time.Second {
+		if !l.wait(chunk, stop) {
+			t.Fatal("wait reported a stop")
+		}
+		total += chunk
+	}
+
+	rate := float64(total) / time.Since(start).Seconds() / (1 << 20)
+	if rate < 0.9 || rate > 1.15 {
+		t.Errorf("got %.3f MByte/s, want about 1", rate)
+	}
+}
+
+func TestRateLimiterStop(t *testing.T) {
+	// A single chunk takes over six seconds at this rate.
+	l := newRateLimiter(0.01, 64<<10)
+	stop := make(chan struct{})
+	time.AfterFunc(50*time.Millisecond, func() { close(stop) })
+
+	start := time.Now()
+	if l.wait(64<<10, stop) {
+		t.Error("wait returned true after the stop")
+	}
+	if took := time.Since(start); took > time.Second {
+		t.Errorf("wait returned %v after the stop", took)
+	}
+}
@@ -0,0 +1,16 @@
+//go:build !windows
+
+package throughput
+
+import (
+	"syscall"
+	"time"
+)
+
+func cpuTime() (user, system time.Duration, err error) {
+	var usage syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &usage); err != nil {
+		return 0, 0, err
+	}
+	return time.Duration(usage.Utime.Nano()), time.Duration(usage.Stime.Nano()), nil
+}
@@ -0,0 +1,12 @@
+//go:build windows
+
+package throughput
+
+import (
+	"errors"
+	"time"
+)
+
+func cpuTime() (user, system time.Duration, err error) {
+	return 0, 0, errors.ErrUnsupported
+}
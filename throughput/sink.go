@@ -0,0 +1,416 @@
+package throughput
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// StatsSink receives the statistics of every interval and, with Note set,
+// the final totals. The calls are serialized.
+type StatsSink interface {
+	Record(s Sample) error
+	Close() error
+}
+
+// Sample holds the statistics of one interval or of the whole run.
+type Sample struct {
+	Timestamp string            `json:"timestamp"`
+	Elapsed   float64           `json:"elapsed"`
+	MBytes    float64           `json:"mbytes"`
+	IOPS      float64           `json:"iops"`
+	Target    float64           `json:"target_mbytes,omitempty"`
+	Latency   *LatencySummary   `json:"latency,omitempty"`
+	Subsample *SubsampleSummary `json:"subsample,omitempty"`
+	Mix       *MixSummary       `json:"mix,omitempty"`
+	Note      string            `json:"note"`
+	Label     string            `json:"label"`
+
+	// The raw interval the console line is built from.
+	written, reads, calls int
+	duration              time.Duration
+	latency               [4]time.Duration
+	total                 int64
+	current               float64
+	windowed              float64
+}
+
+// LatencySummary holds the latency percentiles of an interval in µs.
+type LatencySummary struct {
+	P50 int64 `json:"p50_us"`
+	P95 int64 `json:"p95_us"`
+	P99 int64 `json:"p99_us"`
+	Max int64 `json:"max_us"`
+}
+
+// SubsampleSummary aggregates the -subsample samples of an interval.
+type SubsampleSummary struct {
+	Min  float64 `json:"min_mbytes"`
+	Max  float64 `json:"max_mbytes"`
+	Mean float64 `json:"mean_mbytes"`
+}
+
+// MixSummary splits the throughput of a -rwmix interval into reads and
+// writes.
+type MixSummary struct {
+	Read  float64 `json:"read_mbytes"`
+	Write float64 `json:"write_mbytes"`
+}
+
+var csvHeader = []string{
+	"timestamp",
+	"elapsed_seconds",
+	"throughput_mbytes",
+	"iops",
+	"target_mbytes",
+	"latency_p50_us",
+	"latency_p95_us",
+	"latency_p99_us",
+	"latency_max_us",
+	"subsample_min_mbytes",
+	"subsample_max_mbytes",
+	"subsample_mean_mbytes",
+	"read_mbytes",
+	"write_mbytes",
+	"note",
+	"label",
+}
+
+func (r Sample) csvRow() []string {
+	latency := []string{"", "", "", ""}
+	if r.Latency != nil {
+		latency = []string{
+			fmt.Sprintf("%d", r.Latency.P50),
+			fmt.Sprintf("%d", r.Latency.P95),
+			fmt.Sprintf("%d", r.Latency.P99),
+			fmt.Sprintf("%d", r.Latency.Max),
+		}
+	}
+
+	row := []string{
+		r.Timestamp,
+		fmt.Sprintf("%f", r.Elapsed),
+		fmt.Sprintf("%f", r.MBytes),
+		fmt.Sprintf("%f", r.IOPS),
+		"",
+	}
+	if r.Target > 0 {
+		row[4] = fmt.Sprintf("%f", r.Target)
+	}
+	row = append(row, latency...)
+
+	subsample := []string{"", "", ""}
+	if r.Subsample != nil {
+		subsample = []string{
+			fmt.Sprintf("%f", r.Subsample.Min),
+			fmt.Sprintf("%f", r.Subsample.Max),
+			fmt.Sprintf("%f", r.Subsample.Mean),
+		}
+	}
+	row = append(row, subsample...)
+
+	mix := []string{"", ""}
+	if r.Mix != nil {
+		mix = []string{fmt.Sprintf("%f", r.Mix.Read), fmt.Sprintf("%f", r.Mix.Write)}
+	}
+	row = append(row, mix...)
+
+	return append(row, r.Note, r.Label)
+}
+
+// A sink is given as csv or jsonl with an optional :path, - for stdout and
+// no path for a new timestamped file, or as console for the interval lines.
+func sinkSpecs(cfg Config) []string {
+	if len(cfg.Sinks) > 0 {
+		return cfg.Sinks
+	}
+	specs := []string{"console"}
+	if !cfg.NoCSV {
+		specs = append(specs, cfg.Format+":"+cfg.Statsfile)
+	}
+	return specs
+}
+
+func sinkToStdout(specs []string) bool {
+	for _, spec := range specs {
+		if _, path, _ := strings.Cut(spec, ":"); path == "-" {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *App) openSinks() error {
+	for _, spec := range sinkSpecs(a.cfg) {
+		kind, path, _ := strings.Cut(spec, ":")
+		switch kind {
+		case "console":
+			a.sinks = append(a.sinks, &consoleSink{a: a})
+		case "", "csv", "jsonl":
+			if kind == "" {
+				kind = "csv"
+			}
+			sink, err := newFileSink(kind, path, a.cfg)
+			if err != nil {
+				return err
+			}
+			a.sinks = append(a.sinks, sink)
+		default:
+			return fmt.Errorf("invalid sink %q, must be console, csv[:path] or jsonl[:path]", spec)
+		}
+	}
+	if a.cfg.ProgressFD > 0 {
+		sink, err := newProgressSink(a.cfg.ProgressFD)
+		if err != nil {
+			return err
+		}
+		a.sinks = append(a.sinks, sink)
+	}
+	if a.cfg.PerWorkerCSV {
+		return a.openWorkerLogs()
+	}
+	return nil
+}
+
+// AddSink adds a sink that receives every sample from then on, it is closed
+// by Close.
+func (a *App) AddSink(s StatsSink) {
+	a.statsMu.Lock()
+	defer a.statsMu.Unlock()
+
+	a.sinks = append(a.sinks, s)
+}
+
+// A sink that fails keeps receiving samples, its first error is returned
+// by Close.
+func (a *App) writeRecord(r Sample) {
+	r.Label = a.cfg.Label
+
+	a.statsMu.Lock()
+	defer a.statsMu.Unlock()
+
+	for _, sink := range a.sinks {
+		if err := sink.Record(r); err != nil && a.sinkErr == nil {
+			a.sinkErr = err
+		}
+	}
+}
+
+func (a *App) closeSinks() error {
+	a.statsMu.Lock()
+	defer a.statsMu.Unlock()
+
+	errs := []error{a.sinkErr, a.closeWorkerLogs()}
+	for _, sink := range a.sinks {
+		errs = append(errs, sink.Close())
+	}
+	a.sinks = nil
+	return errors.Join(errs...)
+}
+
+// Rotate closes the statistics files and opens fresh ones, new timestamped
+// files by default or the configured paths again, so external log rotation
+// can move the old ones away. The benchmark keeps running.
+func (a *App) Rotate() error {
+	a.statsMu.Lock()
+	defer a.statsMu.Unlock()
+
+	var errs []error
+	for _, sink := range a.sinks {
+		if f, ok := sink.(*fileSink); ok {
+			errs = append(errs, f.rotate())
+		}
+	}
+	return errors.Join(errs...)
+}
+
+type fileSink struct {
+	format, path string
+	appendStats  bool
+	header       bool
+	file         *os.File
+	csv          *csv.Writer
+	json         *json.Encoder
+}
+
+func newFileSink(format, path string, cfg Config) (*fileSink, error) {
+	s := &fileSink{
+		format:      format,
+		path:        path,
+		appendStats: cfg.AppendStats,
+		header:      format == "csv" && !cfg.NoHeader,
+	}
+	return s, s.open()
+}
+
+func (s *fileSink) open() error {
+	file, err := openStatsfile(s.path, s.format, s.appendStats)
+	if err != nil {
+		return err
+	}
+	s.file = file
+	s.csv = csv.NewWriter(file)
+	s.json = json.NewEncoder(file)
+
+	if s.header && !s.appended() {
+		s.csv.Write(csvHeader)
+		s.csv.Flush()
+	}
+	return s.csv.Error()
+}
+
+func (s *fileSink) Record(r Sample) error {
+	if s.format == "jsonl" {
+		return s.json.Encode(r)
+	}
+	s.csv.Write(r.csvRow())
+	s.csv.Flush()
+	return s.csv.Error()
+}
+
+func (s *fileSink) Close() error {
+	s.csv.Flush()
+	if s.file == os.Stdout {
+		return s.csv.Error()
+	}
+	return errors.Join(s.csv.Error(), s.file.Close())
+}
+
+func (s *fileSink) rotate() error {
+	if s.file == os.Stdout {
+		return nil
+	}
+	if err := s.Close(); err != nil {
+		return err
+	}
+	return s.open()
+}
+
+// An appended file that already has content has its header already.
+func (s *fileSink) appended() bool {
+	if !s.appendStats {
+		return false
+	}
+	info, err := s.file.Stat()
+	return err == nil && info.Size() > 0
+}
+
+func openStatsfile(path, format string, appendStats bool) (*os.File, error) {
+	switch path {
+	case "-":
+		return os.Stdout, nil
+	case "":
+		return createTimestamped(format)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	// Every row is flushed on its own and appended atomically, so runs
+	// sharing a file do not interleave within a row.
+	if appendStats {
+		return os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0666)
+	}
+	return os.Create(path)
+}
+
+// Names a new file after the current second. A rotation or a second sink
+// within the same second gets a counter appended, an existing file is never
+// truncated.
+func createTimestamped(ext string) (*os.File, error) {
+	base := time.Now().Format("2006-01-02_15-04-05")
+	name := base + "." + ext
+	for i := 1; ; i++ {
+		file, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666)
+		if !errors.Is(err, os.ErrExist) {
+			return file, err
+		}
+		name = fmt.Sprintf("%s-%d.%s", base, i, ext)
+	}
+}
+
+// Prints the interval lines, with -print-every one per that many
+// intervals covering the throughput over all of them and the worst
+// latencies and subsamples. The final totals are printed by FinalStats.
+type consoleSink struct {
+	a     *App
+	shown printGroup
+}
+
+type printGroup struct {
+	written, reads, calls int
+	duration              time.Duration
+	latency               [4]time.Duration
+	subMin, subMax        float64
+	subsampled            bool
+	n                     int
+}
+
+func (g *printGroup) add(r Sample) {
+	g.written += r.written
+	g.reads += r.reads
+	g.calls += r.calls
+	g.duration += r.duration
+	for i, l := range r.latency {
+		g.latency[i] = max(g.latency[i], l)
+	}
+	if r.Subsample != nil {
+		if !g.subsampled || r.Subsample.Min < g.subMin {
+			g.subMin = r.Subsample.Min
+		}
+		g.subMax = max(g.subMax, r.Subsample.Max)
+		g.subsampled = true
+	}
+	g.n++
+}
+
+func (s *consoleSink) Record(r Sample) error {
+	a := s.a
+	if r.Note != "" {
+		return nil
+	}
+
+	s.shown.add(r)
+	if s.shown.n < max(a.cfg.PrintEvery, 1) {
+		return nil
+	}
+	g := s.shown
+	s.shown = printGroup{}
+
+	mbytes := mbytesPerSecond(int64(g.written), g.duration)
+	line := formatRate(mbytes, a.cfg.Unit)
+	if a.cfg.Rate > 0 {
+		line = formatTargetRate(mbytes, a.cfg.Rate, a.cfg.Unit)
+	}
+	line += fmt.Sprintf("  (%.0f IOPS)", perSecond(int64(g.calls), g.duration))
+	if a.cfg.EWMA > 0 {
+		line += fmt.Sprintf(" (ewma %s)", formatRate(r.current, a.cfg.Unit))
+	}
+	if a.cfg.Window > 0 {
+		line += fmt.Sprintf(" (%v avg %s)", a.cfg.Window, formatRate(r.windowed, a.cfg.Unit))
+	}
+	if a.cfg.Limit > 0 {
+		line += "  " + progress(r.total, a.cfg.Limit, r.current)
+	}
+	if a.cfg.Spark {
+		line += "  " + a.sparkline(mbytes)
+	}
+	if a.cfg.RWMix > 0 {
+		line += fmt.Sprintf("  (read %s, write %s)", formatRate(mbytesPerSecond(int64(g.reads), g.duration), a.cfg.Unit), formatRate(mbytes, a.cfg.Unit))
+	}
+	if g.subsampled {
+		line += fmt.Sprintf("  (sub min %s, max %s)", formatRate(g.subMin, a.cfg.Unit), formatRate(g.subMax, a.cfg.Unit))
+	}
+	line += fmt.Sprintf("  (p50 %v, p95 %v, p99 %v, max %v)", g.latency[0], g.latency[1], g.latency[2], g.latency[3])
+	_, err := fmt.Fprintln(a.console, line)
+	return err
+}
+
+func (s *consoleSink) Close() error {
+	return nil
+}
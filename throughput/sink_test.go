@@ -0,0 +1,222 @@
+package throughput
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCreateTimestamped(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	first, err := createTimestamped("csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer first.Close()
+	if _, err := first.WriteString("row\n"); err != nil {
+		t.Fatal(err)
+	}
+
+	// A rotation in the same second must not truncate the first file.
+	second, err := createTimestamped("csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer second.Close()
+
+	if first.Name() == second.Name() {
+		t.Fatalf("both files are named %s", first.Name())
+	}
+	content, err := os.ReadFile(first.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "row\n" {
+		t.Errorf("first file holds %q, want its row", content)
+	}
+}
+
+func TestCSVRow(t *testing.T) {
+	full := Sample{
+		Timestamp: "2024-05-01T12:00:00Z",
+		Elapsed:   0.25,
+		MBytes:    100,
+		IOPS:      1600,
+		Target:    120,
+		Latency:   &LatencySummary{P50: 1, P95: 2, P99: 3, Max: 4},
+		Subsample: &SubsampleSummary{Min: 90, Max: 110, Mean: 100},
+		Mix:       &MixSummary{Read: 40, Write: 60},
+		Note:      "total",
+		Label:     "run",
+	}
+	tests := []struct {
+		name   string
+		sample Sample
+		want   map[string]string
+	}{
+		{"full", full, map[string]string{
+			"timestamp":             "2024-05-01T12:00:00Z",
+			"elapsed_seconds":       "0.250000",
+			"throughput_mbytes":     "100.000000",
+			"iops":                  "1600.000000",
+			"target_mbytes":         "120.000000",
+			"latency_p50_us":        "1",
+			"latency_max_us":        "4",
+			"subsample_min_mbytes":  "90.000000",
+			"subsample_mean_mbytes": "100.000000",
+			"read_mbytes":           "40.000000",
+			"write_mbytes":          "60.000000",
+			"note":                  "total",
+			"label":                 "run",
+		}},
+		{"empty", Sample{MBytes: 1}, map[string]string{
+			"throughput_mbytes":    "1.000000",
+			"target_mbytes":        "",
+			"latency_p99_us":       "",
+			"subsample_max_mbytes": "",
+			"read_mbytes":          "",
+			"note":                 "",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			row := tt.sample.csvRow()
+			if len(row) != len(csvHeader) {
+				t.Fatalf("row has %d columns, the header %d", len(row), len(csvHeader))
+			}
+			for column, want := range tt.want {
+				i := slices.Index(csvHeader, column)
+				if i < 0 {
+					t.Fatalf("no column %s", column)
+				}
+				if row[i] != want {
+					t.Errorf("%s = %q, want %q", column, row[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestSampleJSON(t *testing.T) {
+	line, err := json.Marshal(Sample{MBytes: 1, Latency: &LatencySummary{P99: 7}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded map[string]any
+	if err := json.Unmarshal(line, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := decoded["subsample"]; ok {
+		t.Errorf("%s has an empty subsample", line)
+	}
+	latency, _ := decoded["latency"].(map[string]any)
+	if latency["p99_us"] != 7.0 {
+		t.Errorf("%s lacks the p99 latency", line)
+	}
+}
+
+func TestSinks(t *testing.T) {
+	dir := t.TempDir()
+	csvPath, jsonlPath := filepath.Join(dir, "stats.csv"), filepath.Join(dir, "stats.jsonl")
+	runRecorded(t, Config{
+		Chunksize:  4096,
+		IntervalMs: 20 * time.Millisecond,
+		Duration:   100 * time.Millisecond,
+		Sinks:      []string{"csv:" + csvPath, "jsonl:" + jsonlPath},
+	})
+
+	file, err := os.Open(csvPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	rows, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) < 2 || !slices.Equal(rows[0], csvHeader) {
+		t.Fatalf("CSV has %d rows, want the header and the intervals", len(rows))
+	}
+
+	content, err := os.ReadFile(jsonlPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	if len(lines) != len(rows)-1 {
+		t.Errorf("got %d JSON lines and %d CSV rows, want one per sample each", len(lines), len(rows)-1)
+	}
+	for _, line := range lines {
+		var sample Sample
+		if err := json.Unmarshal([]byte(line), &sample); err != nil || sample.Latency == nil {
+			t.Errorf("line %q: %v", line, err)
+		}
+	}
+}
+
+func TestNoCSV(t *testing.T) {
+	for _, noCSV := range []bool{false, true} {
+		t.Chdir(t.TempDir())
+		app, err := NewApp(Config{
+			Outfile:   "out.dat",
+			NoCSV:     noCSV,
+			SyncMode:  "none",
+			Chunksize: 4096,
+			Limit:     1 << 20,
+			Stdout:    io.Discard,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := app.Run(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if err := app.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		files, err := filepath.Glob("*.csv")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if noCSV && len(files) != 0 {
+			t.Errorf("with NoCSV the run created %v", files)
+		}
+		if !noCSV && len(files) != 1 {
+			t.Errorf("without NoCSV the run created %v, want one statistics file", files)
+		}
+	}
+}
+
+func TestConsoleTarget(t *testing.T) {
+	tests := []struct {
+		unit, want string
+	}{
+		{"auto", "48.90/50.00 MByte/s (98%)  (100 IOPS)"},
+		{"MB", "48.900000/50.000000 MByte/s (98%)  (100 IOPS)"},
+	}
+	for _, tt := range tests {
+		var out strings.Builder
+		a := &App{cfg: Config{Rate: 50, Unit: tt.unit}, console: &out}
+		sink := &consoleSink{a: a}
+		if err := sink.Record(Sample{written: 51275366, calls: 100, duration: time.Second}); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(out.String(), tt.want) {
+			t.Errorf("unit %s: got %q, want it to start with %q", tt.unit, out.String(), tt.want)
+		}
+	}
+
+	// The target is given in the unit of the achieved rate.
+	if got := formatTargetRate(0.5, 2, "auto"); got != "512.0/2048.0 KByte/s (25%)" {
+		t.Errorf("formatTargetRate(0.5, 2) = %q", got)
+	}
+}
@@ -0,0 +1,683 @@
+package throughput
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+)
+
+func perSecond(n int64, duration time.Duration) float64 {
+	seconds := duration.Seconds()
+	if seconds <= 0 {
+		return 0
+	}
+	return float64(n) / seconds
+}
+
+func mbytesPerSecond(written int64, duration time.Duration) float64 {
+	return perSecond(written, duration) / 1024 / 1024
+}
+
+// Sorts the samples in place, the caller must not share them with the
+// writer while this runs.
+func latencyPercentiles(samples []time.Duration) (p50, p95, p99 time.Duration) {
+	if len(samples) == 0 {
+		return 0, 0, 0
+	}
+
+	sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+
+	at := func(p float64) time.Duration {
+		return samples[int(p*float64(len(samples)-1))]
+	}
+
+	return at(0.50), at(0.95), at(0.99)
+}
+
+func (a *App) recordInterval(mbytes float64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.stats.Intervals == 0 || mbytes < a.stats.MinMBytes {
+		a.stats.MinMBytes = mbytes
+	}
+	if mbytes > a.stats.MaxMBytes {
+		a.stats.MaxMBytes = mbytes
+	}
+	a.stats.SumMBytes += mbytes
+	a.stats.LastMBytes = mbytes
+	a.stats.Intervals++
+
+	// Welford's online algorithm, the samples themselves are not kept.
+	delta := mbytes - a.stats.MeanMBytes
+	a.stats.MeanMBytes += delta / float64(a.stats.Intervals)
+	a.stats.M2MBytes += delta * (mbytes - a.stats.MeanMBytes)
+}
+
+// Returns the mean, standard deviation and coefficient of variation of the
+// interval throughput.
+func intervalSpread(stats Statistics) (mean, stddev, cv float64) {
+	if stats.Intervals == 0 {
+		return 0, 0, 0
+	}
+	mean = stats.MeanMBytes
+	if stats.Intervals > 1 {
+		stddev = math.Sqrt(stats.M2MBytes / float64(stats.Intervals-1))
+	}
+	if mean > 0 {
+		cv = stddev / mean
+	}
+	return mean, stddev, cv
+}
+
+func (a *App) updateEWMA(mbytes float64) float64 {
+	if !a.ewmaSet {
+		a.ewma = mbytes
+		a.ewmaSet = true
+	} else {
+		a.ewma = a.cfg.EWMA*mbytes + (1-a.cfg.EWMA)*a.ewma
+	}
+	return a.ewma
+}
+
+type windowSample struct {
+	at      time.Time
+	written int
+	elapsed time.Duration
+}
+
+// A ring of the intervals within the trailing -window, sized for all of
+// them so adding never allocates.
+type rollingWindow struct {
+	span    time.Duration
+	samples []windowSample
+	first   int
+	n       int
+}
+
+func newRollingWindow(span, interval time.Duration) rollingWindow {
+	return rollingWindow{span: span, samples: make([]windowSample, int(span/interval)+1)}
+}
+
+// Evicts the intervals that ended before the window and returns the
+// throughput over the rest.
+func (w *rollingWindow) add(at time.Time, written int, elapsed time.Duration) float64 {
+	for w.n > 0 && !w.samples[w.first].at.After(at.Add(-w.span)) {
+		w.first = (w.first + 1) % len(w.samples)
+		w.n--
+	}
+	if w.n == len(w.samples) {
+		w.first = (w.first + 1) % len(w.samples)
+		w.n--
+	}
+	w.samples[(w.first+w.n)%len(w.samples)] = windowSample{at, written, elapsed}
+	w.n++
+
+	var total int64
+	var duration time.Duration
+	for i := range w.n {
+		s := w.samples[(w.first+i)%len(w.samples)]
+		total += int64(s.written)
+		duration += s.elapsed
+	}
+	return mbytesPerSecond(total, duration)
+}
+
+func formatRate(mbytes float64, unit string) string {
+	value, unit, digits := rateParts(mbytes, unit)
+	return fmt.Sprintf("%.*f %syte/s", digits, value, unit)
+}
+
+// Prints the achieved rate over the target, both in the unit and with the
+// digits of the achieved one, e.g. 48.9/50.0 MByte/s (98%).
+func formatTargetRate(mbytes, target float64, unit string) string {
+	value, unit, digits := rateParts(mbytes, unit)
+	return fmt.Sprintf("%.*f/%.*f %syte/s (%.0f%%)", digits, value, digits, scaleRate(target, unit), unit, mbytes/target*100)
+}
+
+// The value, unit and digits formatRate prints mbytes with.
+func rateParts(mbytes float64, unit string) (float64, string, int) {
+	if unit != "auto" {
+		return scaleRate(mbytes, unit), unit, 6
+	}
+
+	switch {
+	case mbytes >= 1024:
+		unit = "GB"
+	case mbytes < 1:
+		unit = "KB"
+	default:
+		unit = "MB"
+	}
+	value := scaleRate(mbytes, unit)
+	digits := 0
+	if value > 0 {
+		digits = max(0, 3-int(math.Floor(math.Log10(value))))
+	}
+	return value, unit, digits
+}
+
+func scaleRate(mbytes float64, unit string) float64 {
+	switch unit {
+	case "KB":
+		return mbytes * 1024
+	case "GB":
+		return mbytes / 1024
+	}
+	return mbytes
+}
+
+func formatBytes(n int64) string {
+	units := []string{"B", "KiB", "MiB", "GiB", "TiB"}
+	value := float64(n)
+	unit := 0
+	for value >= 1024 && unit < len(units)-1 {
+		value /= 1024
+		unit++
+	}
+	return fmt.Sprintf("%.2f %s", value, units[unit])
+}
+
+const sparkWidth = 20
+
+var sparkBars = []rune("▁▂▃▄▅▆▇█")
+
+// Keeps the last sparkWidth interval throughputs in a ring and renders
+// them scaled to their min and max, the newest on the right.
+func (a *App) sparkline(mbytes float64) string {
+	if len(a.spark) < sparkWidth {
+		a.spark = append(a.spark, mbytes)
+	} else {
+		a.spark[a.sparkPos] = mbytes
+		a.sparkPos = (a.sparkPos + 1) % sparkWidth
+	}
+
+	lo, hi := a.spark[0], a.spark[0]
+	for _, v := range a.spark {
+		lo = min(lo, v)
+		hi = max(hi, v)
+	}
+
+	line := make([]rune, 0, len(a.spark))
+	for i := range a.spark {
+		v := a.spark[(a.sparkPos+i)%len(a.spark)]
+		bar := len(sparkBars) - 1
+		if hi > lo {
+			bar = int((v - lo) / (hi - lo) * float64(len(sparkBars)-1))
+		}
+		line = append(line, sparkBars[bar])
+	}
+	return string(line)
+}
+
+// The ETA is extrapolated from the given throughput, the smoothed one if
+// -ewma is set.
+func progress(written, limit int64, mbytes float64) string {
+	line := fmt.Sprintf("(%s/%s, %d%%", formatBytes(written), formatBytes(limit), int(float64(written)*100/float64(limit)))
+	if mbytes > 0 && written < limit {
+		eta := time.Duration(float64(limit-written) / (mbytes * 1024 * 1024) * float64(time.Second))
+		line += fmt.Sprintf(", ETA %v", eta.Round(time.Second))
+	}
+	return line + ")"
+}
+
+const (
+	saturationRatio     = 0.9
+	saturationIntervals = 3
+)
+
+// Below one chunk per interval some intervals see no write at all.
+func (a *App) sparseRate() bool {
+	return a.cfg.Rate > 0 && a.cfg.Rate*1024*1024*a.cfg.IntervalMs.Seconds() < float64(a.cfg.Chunksize)
+}
+
+// Warns once whenever the throughput stays below the -rate target for
+// several intervals in a row, the limiter is then no longer what limits.
+// Bursts idle on purpose and a rate below one chunk per interval measures
+// zero in between, both are left out.
+func (a *App) checkSaturation(mbytes float64, below *int) {
+	if a.cfg.Rate == 0 || a.cfg.BurstOff > 0 || a.sparseRate() {
+		return
+	}
+
+	if mbytes >= a.cfg.Rate*saturationRatio {
+		*below = 0
+		return
+	}
+
+	*below++
+	if *below == saturationIntervals {
+		slog.Warn("throughput below target, the device is saturated", "ratio", saturationRatio, "target", formatRate(a.cfg.Rate, a.cfg.Unit), "intervals", saturationIntervals)
+	}
+}
+
+// A stall is a run of intervals without any progress. Bursts idle on
+// purpose and a rate below one chunk per interval makes empty intervals
+// normal, those runs are left out.
+func (a *App) checkStall(written int, duration time.Duration, streak *time.Duration) {
+	if a.cfg.BurstOff > 0 || a.sparseRate() {
+		return
+	}
+
+	if written > 0 {
+		if *streak > 0 {
+			slog.Warn("stall ended, I/O progressing again", "stalled", streak.Round(time.Millisecond))
+			*streak = 0
+		}
+		return
+	}
+
+	a.mu.Lock()
+	if *streak == 0 {
+		a.stats.Stalls++
+	}
+	a.stats.Stalled += duration
+	a.mu.Unlock()
+
+	if *streak == 0 {
+		slog.Warn("stall, no I/O completed in the interval", "interval", duration.Round(time.Millisecond))
+	}
+	*streak += duration
+}
+
+type subsamples struct {
+	min, max, sum float64
+	n             int
+}
+
+func (s *subsamples) add(mbytes float64) {
+	if s.n == 0 || mbytes < s.min {
+		s.min = mbytes
+	}
+	if mbytes > s.max {
+		s.max = mbytes
+	}
+	s.sum += mbytes
+	s.n++
+}
+
+// With -subsample the throughput is sampled at the finer period from the
+// running interval counter, every interval then reports the aggregate of
+// its samples next to its own average.
+func (a *App) collectStats() {
+	defer a.wg.Done()
+
+	wait := a.cfg.IntervalMs
+	ticks := 1
+	if a.cfg.Subsample > 0 {
+		wait = a.cfg.Subsample
+		ticks = max(1, int(a.cfg.IntervalMs/a.cfg.Subsample))
+	}
+
+	below := 0
+	warned := 0
+	var stall time.Duration
+	var sub subsamples
+	subWritten := 0
+	subLast := time.Now()
+
+	// A ticker keeps the samples on a fixed grid however long the work
+	// takes, ticks missed meanwhile are dropped by the ticker.
+	ticker := time.NewTicker(wait)
+	defer ticker.Stop()
+
+	for tick := 1; ; tick++ {
+		select {
+		case <-ticker.C:
+		case <-a.stop:
+			return
+		}
+
+		if a.cfg.Subsample > 0 {
+			a.mu.Lock()
+			written := a.stats.WrittenBytes
+			a.mu.Unlock()
+
+			now := time.Now()
+			sub.add(mbytesPerSecond(int64(written-subWritten), now.Sub(subLast)))
+			subWritten, subLast = written, now
+			if tick%ticks != 0 {
+				continue
+			}
+		}
+		// A tick the ticker delivered late is followed by one shortly
+		// after, that sliver is folded into the next interval instead of
+		// being reported as an interval of its own.
+		a.mu.Lock()
+		duration := time.Now().Sub(a.stats.LastUpdate)
+		if duration < a.cfg.IntervalMs/2 {
+			a.mu.Unlock()
+			continue
+		}
+		interval := sub
+		sub = subsamples{}
+		written := a.stats.WrittenBytes
+		calls := a.stats.IntervalCalls
+		reads := a.stats.ReadBytes
+		total := a.stats.WrittenBytesTotal
+		maxLatency := a.stats.MaxLatency
+		samples := a.latencies
+		a.latencies = a.spare[:0]
+		a.stats.LastUpdate = time.Now()
+		subWritten, subLast = 0, a.stats.LastUpdate
+		a.stats.WrittenBytes = 0
+		a.stats.IntervalCalls = 0
+		a.stats.ReadBytes = 0
+		a.stats.MaxLatency = 0
+		warming := a.warming
+		warmedUp := warming && subLast.Sub(a.stats.Start) >= a.cfg.Warmup
+		paused := a.paused
+		a.mu.Unlock()
+
+		if warming {
+			a.spare = samples
+			if !a.cfg.Quiet {
+				fmt.Fprintln(a.console, "warming up...")
+			}
+			if warmedUp {
+				a.endWarmup(subLast)
+			}
+			continue
+		}
+
+		mbytes := mbytesPerSecond(int64(written), duration)
+		iops := perSecond(int64(calls), duration)
+		a.recordInterval(mbytes)
+		warned = a.warnLimit(total, warned)
+		if !paused {
+			// The limiter and a stall take the mixed reads into account.
+			a.checkSaturation(mbytes+mbytesPerSecond(int64(reads), duration), &below)
+			a.checkStall(written+reads, duration, &stall)
+		}
+
+		// Quiet runs still track the intervals for the final statistics,
+		// they just skip the output and the percentile sort.
+		if a.cfg.Quiet {
+			a.spare = samples
+			continue
+		}
+
+		p50, p95, p99 := latencyPercentiles(samples)
+		a.spare = samples
+
+		var mix *MixSummary
+		if a.cfg.RWMix > 0 {
+			mix = &MixSummary{Read: mbytesPerSecond(int64(reads), duration), Write: mbytesPerSecond(int64(written), duration)}
+		}
+		var subRecord *SubsampleSummary
+		if interval.n > 0 {
+			subRecord = &SubsampleSummary{Min: interval.min, Max: interval.max, Mean: interval.sum / float64(interval.n)}
+		}
+		current := mbytes
+		if a.cfg.EWMA > 0 {
+			current = a.updateEWMA(mbytes)
+		}
+		var windowed float64
+		if a.cfg.Window > 0 {
+			windowed = a.window.add(time.Now(), written, duration)
+		}
+
+		a.recordWorkers(time.Now(), duration)
+		a.writeRecord(Sample{
+			Timestamp: a.timestamp(time.Now()),
+			Elapsed:   time.Now().Sub(a.stats.Start).Seconds(),
+			MBytes:    mbytes,
+			IOPS:      iops,
+			Target:    a.cfg.Rate,
+			Latency: &LatencySummary{
+				P50: p50.Microseconds(),
+				P95: p95.Microseconds(),
+				P99: p99.Microseconds(),
+				Max: maxLatency.Microseconds(),
+			},
+			Subsample: subRecord,
+			Mix:       mix,
+			written:   written,
+			reads:     reads,
+			calls:     calls,
+			duration:  duration,
+			latency:   [4]time.Duration{p50, p95, p99, maxLatency},
+			total:     total,
+			current:   current,
+			windowed:  windowed,
+		})
+	}
+}
+
+// After a failed run the statistics cover everything written up to the
+// error, which shows how far the run got.
+func (a *App) FinalStats() {
+	a.mu.Lock()
+	stats := a.stats
+	runErr := a.err
+	a.mu.Unlock()
+
+	end := stats.End
+	if end.IsZero() {
+		end = time.Now()
+	}
+	duration := end.Sub(stats.Start) - stats.Paused
+	mbytes := mbytesPerSecond(stats.WrittenBytesTotal, duration)
+
+	if a.cfg.Tail {
+		fmt.Fprintf(a.console, "%f\n", mbytes)
+	} else {
+		fmt.Fprintf(a.console, "Total: %s\n", formatRate(mbytes, a.cfg.Unit))
+	}
+	if a.cfg.RWMix > 0 && !a.cfg.Tail {
+		reads := mbytesPerSecond(stats.ReadBytesTotal, duration)
+		writes := mbytesPerSecond(stats.WrittenBytesTotal, duration)
+		fmt.Fprintf(a.console, "Read: %s, write: %s\n", formatRate(reads, a.cfg.Unit), formatRate(writes, a.cfg.Unit))
+	}
+	if a.cfg.SparseRatio > 0 && !a.cfg.Tail {
+		fmt.Fprintf(a.console, "Logical size: %s, written: %s, holes: %s\n", formatBytes(stats.WrittenBytesTotal+stats.HoleBytes), formatBytes(stats.WrittenBytesTotal), formatBytes(stats.HoleBytes))
+	}
+	for _, w := range a.workers {
+		if w.sum != nil && !a.cfg.Tail {
+			fmt.Fprintf(a.console, "Checksum %s %s: %s\n", a.cfg.Checksum, w.file.Name(), w.digest())
+		}
+	}
+	if runErr != nil {
+		slog.Error("aborted", "bytes", stats.WrittenBytesTotal, "duration", duration.Round(time.Millisecond), "err", runErr)
+	}
+	if stats.Intervals > 0 && !a.cfg.Quiet {
+		mean, stddev, cv := intervalSpread(stats)
+		fmt.Fprintf(a.console, "Intervals: mean %s, stddev %s, cv %.1f%%\n", formatRate(mean, a.cfg.Unit), formatRate(stddev, a.cfg.Unit), cv*100)
+	}
+
+	if a.cfg.Summary {
+		printSummary(a.cfg.Stderr, stats, duration)
+	}
+
+	if a.cfg.JSONSummary {
+		a.printJSONSummary(stats, duration, mbytes, runErr)
+	}
+
+	if a.cfg.Histfile != "" {
+		a.mu.Lock()
+		hist := a.hist
+		a.mu.Unlock()
+		if err := hist.write(a.cfg.Histfile); err != nil {
+			slog.Error("writing histogram failed", "file", a.cfg.Histfile, "err", err)
+		}
+	}
+
+	if a.cfg.Plot != "" {
+		a.writePlots()
+	}
+
+	note := "End"
+	if runErr != nil {
+		note = "Error: " + runErr.Error()
+	}
+	a.finishWorkers(duration, note)
+
+	a.writeRecord(Sample{
+		Timestamp: a.timestamp(time.Now()),
+		Elapsed:   duration.Seconds(),
+		MBytes:    mbytes,
+		IOPS:      perSecond(int64(stats.Calls), duration),
+		Note:      note,
+		total:     stats.WrittenBytesTotal,
+	})
+}
+
+// Logs every -limit-warn percentage of the limit the total crossed since
+// the last call, passed counts the ones logged before.
+func (a *App) warnLimit(total int64, passed int) int {
+	if a.cfg.Limit == 0 {
+		return passed
+	}
+	for ; passed < len(a.cfg.LimitWarn); passed++ {
+		percent := a.cfg.LimitWarn[passed]
+		if float64(total) < percent/100*float64(a.cfg.Limit) {
+			break
+		}
+		slog.Info("approaching limit", "written", formatBytes(total), "limit", formatBytes(a.cfg.Limit), "percent", percent)
+	}
+	return passed
+}
+
+// The p99 exceeds MaxP99 exactly when more than one percent of the calls
+// took longer, so counting those is enough and needs no samples.
+func (a *App) SLOViolations() []error {
+	a.mu.Lock()
+	stats := a.stats
+	a.mu.Unlock()
+
+	end := stats.End
+	if end.IsZero() {
+		end = time.Now()
+	}
+	duration := end.Sub(stats.Start) - stats.Paused
+
+	var errs []error
+	if a.cfg.MaxP99 > 0 && stats.SlowCalls*100 > stats.Calls {
+		errs = append(errs, fmt.Errorf("p99 latency above %v, %d of %d calls (%.2f%%) were slower", a.cfg.MaxP99, stats.SlowCalls, stats.Calls, float64(stats.SlowCalls)*100/float64(stats.Calls)))
+	}
+	if mbytes := mbytesPerSecond(stats.WrittenBytesTotal, duration); a.cfg.MinThroughput > 0 && mbytes < a.cfg.MinThroughput {
+		errs = append(errs, fmt.Errorf("throughput %s below %s", formatRate(mbytes, a.cfg.Unit), formatRate(a.cfg.MinThroughput, a.cfg.Unit)))
+	}
+	return errs
+}
+
+func printSummary(w io.Writer, stats Statistics, duration time.Duration) {
+	avg := 0.0
+	if stats.Intervals > 0 {
+		avg = stats.SumMBytes / float64(stats.Intervals)
+	}
+
+	fmt.Fprintln(w, "Summary:")
+	fmt.Fprintf(w, "  Bytes:        %s\n", formatBytes(stats.WrittenBytesTotal))
+	fmt.Fprintf(w, "  Duration:     %v\n", duration.Round(time.Millisecond))
+	fmt.Fprintf(w, "  Calls:        %d\n", stats.Calls)
+	fmt.Fprintf(w, "  IOPS:         %.0f\n", perSecond(int64(stats.Calls), duration))
+	fmt.Fprintf(w, "  Short writes: %d\n", stats.ShortWrites)
+	if sizes := stats.WriteSizes; sizes[4]+sizes.partial() > 0 {
+		fmt.Fprintf(w, "  Write sizes:  %d full, %d at 75-99%%, %d at 50-74%%, %d at 25-49%%, %d below 25%%\n", sizes[4], sizes[3], sizes[2], sizes[1], sizes[0])
+	}
+	fmt.Fprintf(w, "  Syncs:        %d\n", stats.Syncs)
+	if stats.Syncs > 0 && stats.Calls > 0 {
+		write, sync := stats.WriteTime/time.Duration(stats.Calls), stats.SyncTime/time.Duration(stats.Syncs)
+		share := float64(stats.SyncTime) / float64(stats.WriteTime+stats.SyncTime) * 100
+		fmt.Fprintf(w, "  Latency:      write avg %v, sync avg %v, syncs %.1f%% of the I/O time\n", write.Round(time.Microsecond), sync.Round(time.Microsecond), share)
+	}
+	fmt.Fprintf(w, "  Sync errors:  %d\n", stats.SyncErrors)
+	fmt.Fprintf(w, "  Full disk:    %d retries\n", stats.ENOSPCRetries)
+	fmt.Fprintf(w, "  Stalls:       %d, %v stalled\n", stats.Stalls, stats.Stalled.Round(time.Millisecond))
+	if stats.PhysicalBytes >= 0 && stats.WrittenBytesTotal > 0 {
+		fmt.Fprintf(w, "  Device:       %s written, amplification %.2fx\n", formatBytes(stats.PhysicalBytes), amplification(stats))
+	}
+	if cpu, seconds := (stats.UserCPU + stats.SystemCPU).Seconds(), duration.Seconds(); cpu > 0 && seconds > 0 {
+		fmt.Fprintf(w, "  CPU:          user %.3fs, system %.3fs, %.1f%% of wall clock\n", stats.UserCPU.Seconds(), stats.SystemCPU.Seconds(), cpu/seconds*100)
+	}
+	fmt.Fprintf(w, "  Interval:     min %f, avg %f, max %f MByte/s\n", stats.MinMBytes, avg, stats.MaxMBytes)
+}
+
+// Bytes the device wrote per byte the run wrote.
+func amplification(stats Statistics) float64 {
+	return float64(stats.PhysicalBytes) / float64(stats.WrittenBytesTotal)
+}
+
+type jsonSummary struct {
+	TotalBytes      int64             `json:"total_bytes"`
+	DurationSeconds float64           `json:"duration_seconds"`
+	AvgMBytes       float64           `json:"avg_mbytes"`
+	PeakMBytes      float64           `json:"peak_mbytes"`
+	MinMBytes       float64           `json:"min_mbytes"`
+	WriteCalls      int               `json:"write_calls"`
+	ShortWrites     int               `json:"short_writes"`
+	WriteSizes      map[string]int    `json:"write_sizes"`
+	Syncs           int               `json:"syncs"`
+	AvgWriteUs      int64             `json:"avg_write_latency_us"`
+	AvgSyncUs       int64             `json:"avg_sync_latency_us,omitempty"`
+	Stalls          int               `json:"stalls"`
+	StalledSeconds  float64           `json:"stalled_seconds"`
+	Errors          int               `json:"errors"`
+	PhysicalBytes   *int64            `json:"physical_bytes,omitempty"`
+	Amplification   *float64          `json:"write_amplification,omitempty"`
+	Checksums       map[string]string `json:"checksums,omitempty"`
+	Error           string            `json:"error,omitempty"`
+}
+
+func (a *App) printJSONSummary(stats Statistics, duration time.Duration, mbytes float64, runErr error) {
+	summary := jsonSummary{
+		TotalBytes:      stats.WrittenBytesTotal,
+		DurationSeconds: duration.Seconds(),
+		AvgMBytes:       mbytes,
+		PeakMBytes:      stats.MaxMBytes,
+		MinMBytes:       stats.MinMBytes,
+		WriteCalls:      stats.Calls,
+		ShortWrites:     stats.ShortWrites,
+		WriteSizes: map[string]int{
+			"full":   stats.WriteSizes[4],
+			"75-99%": stats.WriteSizes[3],
+			"50-74%": stats.WriteSizes[2],
+			"25-49%": stats.WriteSizes[1],
+			"0-24%":  stats.WriteSizes[0],
+		},
+		Syncs:          stats.Syncs,
+		Stalls:         stats.Stalls,
+		StalledSeconds: stats.Stalled.Seconds(),
+		Errors:         stats.Errors + stats.SyncErrors,
+	}
+	if stats.Calls > 0 {
+		summary.AvgWriteUs = (stats.WriteTime / time.Duration(stats.Calls)).Microseconds()
+	}
+	if stats.Syncs > 0 {
+		summary.AvgSyncUs = (stats.SyncTime / time.Duration(stats.Syncs)).Microseconds()
+	}
+	for _, w := range a.workers {
+		if w.sum != nil {
+			if summary.Checksums == nil {
+				summary.Checksums = map[string]string{}
+			}
+			summary.Checksums[w.file.Name()] = w.digest()
+		}
+	}
+	if stats.PhysicalBytes >= 0 && stats.WrittenBytesTotal > 0 {
+		amp := amplification(stats)
+		summary.PhysicalBytes, summary.Amplification = &stats.PhysicalBytes, &amp
+	}
+	if runErr != nil {
+		summary.Error = runErr.Error()
+	}
+	json.NewEncoder(a.cfg.Stdout).Encode(summary)
+}
+
+func (a *App) timestamp(t time.Time) string {
+	switch a.cfg.TimeFormat {
+	case "compact":
+		return t.Format("2006-01-02_15-04-05")
+	case "rfc3339":
+		return t.Format(time.RFC3339)
+	case "unixnano":
+		return strconv.FormatInt(t.UnixNano(), 10)
+	}
+	return t.Format(time.RFC3339Nano)
+}
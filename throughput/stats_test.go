@@ -0,0 +1,120 @@
+package throughput
+
+import (
+	"context"
+	"encoding/csv"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Keeps every sample it receives.
+type recordingSink struct {
+	mu      sync.Mutex
+	samples []Sample
+}
+
+func (s *recordingSink) Record(r Sample) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.samples = append(s.samples, r)
+	return nil
+}
+
+func (s *recordingSink) Close() error {
+	return nil
+}
+
+// Runs a benchmark writing to a temporary file and returns the interval
+// samples.
+func runRecorded(t *testing.T, cfg Config) []Sample {
+	t.Helper()
+	cfg.Outfile = filepath.Join(t.TempDir(), "out.dat")
+	cfg.NoCSV = true
+	cfg.SyncMode = "none"
+	cfg.Stdout = io.Discard
+
+	app, err := NewApp(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink := &recordingSink{}
+	app.AddSink(sink)
+	if err := app.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return sink.samples
+}
+
+func TestWarmupEndsOnTick(t *testing.T) {
+	interval := 20 * time.Millisecond
+	samples := runRecorded(t, Config{
+		Chunksize:  4096,
+		IntervalMs: interval,
+		Warmup:     3 * interval,
+		Duration:   10 * interval,
+	})
+
+	if len(samples) < 5 {
+		t.Fatalf("got %d samples, want about 10", len(samples))
+	}
+	for i, s := range samples {
+		if s.duration < interval/2 {
+			t.Errorf("sample %d covers %v, want about %v", i, s.duration, interval)
+		}
+	}
+}
+
+func TestFirstRow(t *testing.T) {
+	dir := t.TempDir()
+	statsfile := filepath.Join(dir, "stats.csv")
+	interval := 50 * time.Millisecond
+	app, err := NewApp(Config{
+		Outfile:    filepath.Join(dir, "out.dat"),
+		Statsfile:  statsfile,
+		SyncMode:   "none",
+		Chunksize:  4096,
+		IntervalMs: interval,
+		Duration:   3 * interval,
+		Stdout:     io.Discard,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := app.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := os.Open(statsfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	rows, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) < 2 {
+		t.Fatalf("got %d rows, want a header and at least one interval", len(rows))
+	}
+
+	elapsed, _ := strconv.ParseFloat(rows[1][1], 64)
+	mbytes, _ := strconv.ParseFloat(rows[1][2], 64)
+	if elapsed < interval.Seconds()/2 || elapsed > 2*interval.Seconds() {
+		t.Errorf("first row at %v s, want about one interval of %v", elapsed, interval)
+	}
+	// Measured since year 1 the first row would be close to 0.
+	if mbytes < 1 {
+		t.Errorf("first row reports %v MByte/s, want a real throughput", mbytes)
+	}
+}
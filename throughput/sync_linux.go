@@ -0,0 +1,12 @@
+//go:build linux
+
+package throughput
+
+import (
+	"os"
+	"syscall"
+)
+
+func fdatasync(f *os.File) error {
+	return syscall.Fdatasync(int(f.Fd()))
+}
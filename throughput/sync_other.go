@@ -0,0 +1,9 @@
+//go:build !linux
+
+package throughput
+
+import "os"
+
+func fdatasync(f *os.File) error {
+	return f.Sync()
+}
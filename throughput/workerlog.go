@@ -0,0 +1,141 @@
+package throughput
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// The slowest worker below this share of the fastest one's throughput
+// is reported as an imbalance.
+const imbalanceRatio = 0.8
+
+var workerCSVHeader = []string{
+	"timestamp",
+	"elapsed_seconds",
+	"throughput_mbytes",
+	"iops",
+	"total_bytes",
+	"note",
+}
+
+// The CSV file of one worker next to the aggregate one, with the bytes
+// and calls already reported.
+type workerLog struct {
+	file  *os.File
+	csv   *csv.Writer
+	bytes int64
+	calls int
+}
+
+// Every worker gets <statsfile>.worker<N>.csv, named after the first CSV
+// statistics file.
+func (a *App) openWorkerLogs() error {
+	base := ""
+	for _, sink := range a.sinks {
+		if f, ok := sink.(*fileSink); ok && f.format == "csv" && f.file != os.Stdout {
+			base = strings.TrimSuffix(f.file.Name(), filepath.Ext(f.file.Name()))
+			break
+		}
+	}
+	if base == "" {
+		return errors.New("per worker statistics require a CSV statistics file")
+	}
+
+	for i := range a.workers {
+		file, err := openStatsfile(fmt.Sprintf("%s.worker%d.csv", base, i), "csv", a.cfg.AppendStats)
+		if err != nil {
+			return err
+		}
+		log := &workerLog{file: file, csv: csv.NewWriter(file)}
+		if info, err := file.Stat(); !a.cfg.NoHeader && (err != nil || info.Size() == 0) {
+			log.csv.Write(workerCSVHeader)
+			log.csv.Flush()
+		}
+		a.workerLogs = append(a.workerLogs, log)
+	}
+	return nil
+}
+
+// Bytes and calls of a worker since the statistics started.
+func (a *App) workerTotals(w *worker) (int64, int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return w.written - w.warmupWritten, w.calls - w.warmupCalls
+}
+
+func (a *App) recordWorkers(now time.Time, duration time.Duration) {
+	a.statsMu.Lock()
+	defer a.statsMu.Unlock()
+
+	for i, log := range a.workerLogs {
+		bytes, calls := a.workerTotals(a.workers[i])
+		log.csv.Write([]string{
+			a.timestamp(now),
+			fmt.Sprintf("%f", now.Sub(a.stats.Start).Seconds()),
+			fmt.Sprintf("%f", mbytesPerSecond(bytes-log.bytes, duration)),
+			fmt.Sprintf("%f", perSecond(int64(calls-log.calls), duration)),
+			fmt.Sprint(bytes),
+			"",
+		})
+		log.csv.Flush()
+		if err := log.csv.Error(); err != nil && a.sinkErr == nil {
+			a.sinkErr = err
+		}
+		log.bytes, log.calls = bytes, calls
+	}
+}
+
+// Prints the totals of every worker, writes them as the last row of its
+// file and warns when the slowest worker lags far behind the fastest.
+func (a *App) finishWorkers(duration time.Duration, note string) {
+	a.statsMu.Lock()
+	defer a.statsMu.Unlock()
+
+	var slowest, fastest int
+	rates := make([]float64, len(a.workerLogs))
+	for i, log := range a.workerLogs {
+		w := a.workers[i]
+		bytes, calls := a.workerTotals(w)
+		rates[i] = mbytesPerSecond(bytes, duration)
+		fmt.Fprintf(a.console, "Worker %d %s: %s, %s\n", i, w.file.Name(), formatBytes(bytes), formatRate(rates[i], a.cfg.Unit))
+
+		log.csv.Write([]string{
+			a.timestamp(time.Now()),
+			fmt.Sprintf("%f", duration.Seconds()),
+			fmt.Sprintf("%f", rates[i]),
+			fmt.Sprintf("%f", perSecond(int64(calls), duration)),
+			fmt.Sprint(bytes),
+			note,
+		})
+		log.csv.Flush()
+
+		if rates[i] < rates[slowest] {
+			slowest = i
+		}
+		if rates[i] > rates[fastest] {
+			fastest = i
+		}
+	}
+
+	if len(rates) > 1 && rates[slowest] < imbalanceRatio*rates[fastest] {
+		slog.Warn("workers imbalanced",
+			"slowest", a.workers[slowest].file.Name(), "slowest_mbytes", rates[slowest],
+			"fastest", a.workers[fastest].file.Name(), "fastest_mbytes", rates[fastest])
+	}
+}
+
+func (a *App) closeWorkerLogs() error {
+	var errs []error
+	for _, log := range a.workerLogs {
+		log.csv.Flush()
+		errs = append(errs, log.csv.Error(), log.file.Close())
+	}
+	a.workerLogs = nil
+	return errors.Join(errs...)
+}
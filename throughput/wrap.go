@@ -0,0 +1,32 @@
+package throughput
+
+import (
+	"bufio"
+	"compress/gzip"
+	"io"
+)
+
+// A wrapper sits between the benchmark and the file, the throughput then
+// counts the bytes offered to it rather than those reaching the file.
+type wrapper interface {
+	io.Writer
+	Flush() error
+}
+
+func newWrapper(cfg Config, w io.Writer) wrapper {
+	switch cfg.Wrap {
+	case "buffered":
+		return bufio.NewWriterSize(w, cfg.WrapSize)
+	case "gzip":
+		return gzip.NewWriter(w)
+	}
+	return nil
+}
+
+// Writes out whatever the wrapper still holds, gzip adds its trailer.
+func closeWrapper(w wrapper) error {
+	if c, ok := w.(io.Closer); ok {
+		return c.Close()
+	}
+	return w.Flush()
+}
@@ -0,0 +1,42 @@
+//go:build linux
+
+package throughput
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// Every worker keeps its iovecs, so the write loop does not allocate. A
+// batch is only written with a queue depth of 1, one writer per worker.
+type iovecs []syscall.Iovec
+
+func writev(f *os.File, bufs [][]byte, scratch *iovecs) (int, error) {
+	iovecs := (*scratch)[:0]
+	for _, buf := range bufs {
+		iovec := syscall.Iovec{Base: unsafe.SliceData(buf)}
+		iovec.SetLen(len(buf))
+		iovecs = append(iovecs, iovec)
+	}
+	*scratch = iovecs
+
+	conn, err := f.SyscallConn()
+	if err != nil {
+		return 0, err
+	}
+
+	var n uintptr
+	var errno syscall.Errno
+	err = conn.Write(func(fd uintptr) bool {
+		n, _, errno = syscall.Syscall(syscall.SYS_WRITEV, fd, uintptr(unsafe.Pointer(&iovecs[0])), uintptr(len(iovecs)))
+		return errno != syscall.EAGAIN
+	})
+	if err != nil {
+		return 0, err
+	}
+	if errno != 0 {
+		return 0, &os.PathError{Op: "writev", Path: f.Name(), Err: errno}
+	}
+	return int(n), nil
+}
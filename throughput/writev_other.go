@@ -0,0 +1,20 @@
+//go:build !linux
+
+package throughput
+
+import "os"
+
+type iovecs struct{}
+
+// Without writev the chunks of a batch are written one by one.
+func writev(f *os.File, bufs [][]byte, _ *iovecs) (int, error) {
+	written := 0
+	for _, buf := range bufs {
+		n, err := f.Write(buf)
+		written += n
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}